@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -14,8 +16,12 @@ import (
 	"github.com/dskvich/ai-bot/pkg/database"
 	"github.com/dskvich/ai-bot/pkg/domain"
 	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/llm/anthropic"
+	"github.com/dskvich/ai-bot/pkg/llm/fake"
+	"github.com/dskvich/ai-bot/pkg/llm/gemini"
 	"github.com/dskvich/ai-bot/pkg/llm/openai"
 	"github.com/dskvich/ai-bot/pkg/llm/replicate"
+	"github.com/dskvich/ai-bot/pkg/llm/tools"
 	"github.com/dskvich/ai-bot/pkg/logger"
 	"github.com/dskvich/ai-bot/pkg/repository"
 	"github.com/dskvich/ai-bot/pkg/services"
@@ -23,16 +29,125 @@ import (
 	"github.com/dskvich/ai-bot/pkg/telegram/matchers"
 	"github.com/dskvich/ai-bot/pkg/telegram/middleware"
 	"github.com/go-telegram/bot"
+	"github.com/samber/lo"
 )
 
 type Config struct {
-	OpenAIToken               string  `env:"OPEN_AI_TOKEN,required"`
-	ReplicateToken            string  `env:"REPLICATE_API_TOKEN,required"`
-	TelegramBotToken          string  `env:"TELEGRAM_BOT_TOKEN,required"`
-	TelegramAuthorizedUserIDs []int64 `env:"TELEGRAM_AUTHORIZED_USER_IDS" envSeparator:" "`
-	PgURL                     string  `env:"DATABASE_URL"`
-	PgHost                    string  `env:"DB_HOST" envDefault:"localhost:61234"`
-	BunDebug                  int     `env:"BUNDEBUG" envDefault:"0"`
+	FakeProviders             bool                        `env:"FAKE_PROVIDERS"` // Answer offline instead of calling OpenAI and Replicate
+	OpenAIToken               string                      `env:"OPEN_AI_TOKEN"`
+	OpenAIBaseURL             string                      `env:"OPEN_AI_BASE_URL" envDefault:"https://api.openai.com/v1"`
+	ReplicateToken            string                      `env:"REPLICATE_API_TOKEN"`
+	ReplicateBaseURL          string                      `env:"REPLICATE_BASE_URL" envDefault:"https://api.replicate.com/v1"`
+	ReplicateModels           replicate.Models            `env:"REPLICATE_MODELS"`         // Specs of the models offered along with or instead of the default ones
+	ReplicateWebhookURL       string                      `env:"REPLICATE_WEBHOOK_URL"`    // Public URL of the webhook service, empty only polls predictions
+	ReplicateWebhookSecret    string                      `env:"REPLICATE_WEBHOOK_SECRET"` // Signing secret of the webhooks, required along with the URL
+	WebhookAddr               string                      `env:"WEBHOOK_ADDR" envDefault:":8080"`
+	ImageWorkers              int                         `env:"IMAGE_WORKERS" envDefault:"2"` // Image jobs drawn at once
+	ImageQueuePollInterval    time.Duration               `env:"IMAGE_QUEUE_POLL_INTERVAL" envDefault:"2s"`
+	AnthropicToken            string                      `env:"ANTHROPIC_API_KEY"`
+	AnthropicBaseURL          string                      `env:"ANTHROPIC_BASE_URL" envDefault:"https://api.anthropic.com/v1"`
+	GeminiToken               string                      `env:"GEMINI_API_KEY"`
+	GeminiBaseURL             string                      `env:"GEMINI_BASE_URL" envDefault:"https://generativelanguage.googleapis.com/v1beta"`
+	CompatibleProviders       compatibleProviders         `env:"OPENAI_COMPATIBLE_PROVIDERS"`
+	ModelFallbacks            modelFallbacks              `env:"MODEL_FALLBACKS"`
+	ModelPrices               modelPrices                 `env:"MODEL_PRICES"`
+	ModelsAllow               []string                    `env:"MODELS_ALLOW" envSeparator:","` // Globs of the model IDs offered, empty offers all
+	ModelsDeny                []string                    `env:"MODELS_DENY" envSeparator:"," envDefault:"*-[0-9][0-9][0-9][0-9]*,*preview*,*-exp*"`
+	CapabilityPolicy          domain.CapabilityPolicy     `env:"CAPABILITY_POLICY" envDefault:"reject"` // Whether requests the chat model can't handle are rejected or rerouted
+	IntentClassifier          domain.IntentClassifierKind `env:"INTENT_CLASSIFIER" envDefault:"llm"`    // Whether a model or keywords tell chat from image requests
+	ModelCatalogRefresh       time.Duration               `env:"MODEL_CATALOG_REFRESH_INTERVAL" envDefault:"1h"`
+	HistorySummaryModel       string                      `env:"HISTORY_SUMMARY_MODEL"` // Empty keeps wiping history on TTL
+	HistorySummaryMaxTokens   int                         `env:"HISTORY_SUMMARY_MAX_TOKENS" envDefault:"8000"`
+	TelegramBotToken          string                      `env:"TELEGRAM_BOT_TOKEN,required"`
+	TelegramAuthorizedUserIDs []int64                     `env:"TELEGRAM_AUTHORIZED_USER_IDS" envSeparator:" "`
+	TelegramAdminUserIDs      []int64                     `env:"TELEGRAM_ADMIN_USER_IDS" envSeparator:" "`
+	DailyUserLimit            float64                     `env:"DAILY_USER_LIMIT"`     // USD, 0 means no limit
+	MonthlyUserLimit          float64                     `env:"MONTHLY_USER_LIMIT"`   // USD, 0 means no limit
+	MonthlyGlobalLimit        float64                     `env:"MONTHLY_GLOBAL_LIMIT"` // USD for all users together, 0 means no limit
+	PgURL                     string                      `env:"DATABASE_URL"`
+	PgHost                    string                      `env:"DB_HOST" envDefault:"localhost:61234"`
+	BunDebug                  int                         `env:"BUNDEBUG" envDefault:"0"`
+}
+
+// compatibleProviders lists servers speaking the OpenAI chat completions protocol, as a JSON array:
+// [{"name":"ollama","base_url":"http://localhost:11434/v1","models":["llama3.1"]}].
+type compatibleProviders []compatibleProvider
+
+type compatibleProvider struct {
+	Name    string   `json:"name"`
+	BaseURL string   `json:"base_url"`
+	Token   string   `json:"token"`
+	Models  []string `json:"models"`
+	Tools   bool     `json:"tools"` // Whether the served models support function calling
+}
+
+func (p *compatibleProviders) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]compatibleProvider)(p))
+}
+
+// imageService is what the bot uses Replicate for, implemented by the Replicate client and the offline fake.
+type imageService interface {
+	llm.ImageGenerator
+	llm.ImageEditor
+	llm.ImageUpscaler
+	llm.ImageSubmitter
+	services.PredictionReader
+	services.PredictionPoller
+}
+
+// openAIService is what the bot uses OpenAI for, implemented by the OpenAI client and its offline fake.
+type openAIService interface {
+	llm.TextGenerator
+	llm.ImageGenerator
+	llm.ImageEditor
+	llm.IntentClassifier
+	GenerateImagePrompt(ctx context.Context, prompt string) (string, error)
+	TranscribeAudio(ctx context.Context, audioFilePath string) (string, error)
+}
+
+// modelFallbacks lists per model the models tried in order when it fails, as a JSON object:
+// {"o3-mini":["gpt-4o-mini"],"flux-1.1-pro-ultra":["dall-e-3"]}.
+type modelFallbacks map[string][]string
+
+func (f *modelFallbacks) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*map[string][]string)(f))
+}
+
+// modelPrices lists prices of models missing from the built-in table or overriding it, as a JSON object:
+// {"gpt-4.1":{"input_per_million":2,"output_per_million":8},"flux-schnell":{"per_image":0.003}}.
+type modelPrices map[string]domain.Price
+
+func (p *modelPrices) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*map[string]domain.Price)(p))
+}
+
+// split divides the chains between text and image models and checks that every
+// chain consists of models of a single kind. Models missing from the catalog are
+// allowed, as they may be discovered later, but every chain needs a known one.
+func (f modelFallbacks) split(catalog *llm.ModelCatalog) (text, image llm.FallbackChains, err error) {
+	text, image = llm.FallbackChains{}, llm.FallbackChains{}
+
+	for model, fallbacks := range f {
+		chain := append([]string{model}, fallbacks...)
+
+		kinds := lo.Uniq(lo.FilterMap(chain, func(m string, _ int) (domain.ModelKind, bool) {
+			info, ok := catalog.Model(m)
+			return info.Kind, ok
+		}))
+
+		switch {
+		case len(kinds) == 0:
+			return nil, nil, fmt.Errorf("fallback chain %v has no supported models", chain)
+		case len(kinds) > 1:
+			return nil, nil, fmt.Errorf("fallback chain %v mixes models of different kinds", chain)
+		case kinds[0] == domain.ModelKindText:
+			text[model] = fallbacks
+		default:
+			image[model] = fallbacks
+		}
+	}
+
+	return text, image, nil
 }
 
 func main() {
@@ -74,6 +189,13 @@ func setupServices(ctx context.Context) (services.Group, error) {
 		return nil, fmt.Errorf("parsing env config: %w", err)
 	}
 
+	// Unsigned webhooks would let anyone post images into chats
+	if cfg.ReplicateWebhookURL != "" && cfg.ReplicateWebhookSecret == "" {
+		return nil, errors.New("REPLICATE_WEBHOOK_SECRET is required along with REPLICATE_WEBHOOK_URL")
+	}
+
+	domain.SetPrices(cfg.ModelPrices)
+
 	var svc services.Service
 	var svcGroup services.Group
 
@@ -82,43 +204,181 @@ func setupServices(ctx context.Context) (services.Group, error) {
 		return nil, fmt.Errorf("initializing database: %w", err)
 	}
 
-	openAIClient, err := openai.NewClient(cfg.OpenAIToken)
-	if err != nil {
-		return nil, fmt.Errorf("creating open ai client: %w", err)
-	}
+	toolRegistry := tools.Builtin()
 
-	replicateClient, err := replicate.NewClient(cfg.ReplicateToken)
-	if err != nil {
-		return nil, fmt.Errorf("creating replicate client: %w", err)
+	var (
+		openAIClient    openAIService
+		replicateClient imageService
+	)
+
+	replicateModels := replicate.DefaultModels.Merge(cfg.ReplicateModels)
+
+	if cfg.FakeProviders {
+		fakeClient := fake.NewClient(fake.WithWebhook(cfg.ReplicateWebhookURL, cfg.ReplicateWebhookSecret))
+		openAIClient, replicateClient = fakeClient, fakeClient
+		slog.Warn("using fake providers, OpenAI and Replicate models answer offline")
+	} else {
+		if openAIClient, err = openai.NewClient(cfg.OpenAIToken, openai.WithBaseURL(cfg.OpenAIBaseURL), openai.WithTools(toolRegistry)); err != nil {
+			return nil, fmt.Errorf("creating open ai client: %w", err)
+		}
+
+		if replicateClient, err = replicate.NewClient(cfg.ReplicateToken, cfg.ReplicateBaseURL, replicate.WithModels(replicateModels), replicate.WithWebhook(cfg.ReplicateWebhookURL, cfg.ReplicateWebhookSecret)); err != nil {
+			return nil, fmt.Errorf("creating replicate client: %w", err)
+		}
 	}
 
 	chatRepository := repository.NewChatRepository(db)
 	stateRepository := repository.NewStateRepository()
 	promptRepository := repository.NewPromptRepository(db)
+	imageRepository := repository.NewImageRepository(db)
+	usageRepository := repository.NewUsageRepository(db)
+	quotaRepository := repository.NewQuotaRepository(db)
+	imageJobRepository := repository.NewImageJobRepository(db)
 
 	// Price per 1M tokens (Input/Output)
 	// https://platform.openai.com/docs/pricing
-	supportedTextModels := []string{
-		"gpt-4o-mini",   // $0.15/$0.60
-		"gpt-3.5-turbo", // $0.50/$1.50
-		"o3-mini",       // $1.10/$4.40
-		// "gpt-4o",        // $2.50/$10.00
-		// "gpt-4-turbo",   // $10.00/$30.00
+	openAISource := llm.CatalogSource{
+		Provider: "openai",
+		Text:     openAIClient,
+		Image:    openAIClient,
+		Editor:   openAIClient,
+		TextModels: []string{
+			domain.Gpt4oMiniModel,  // $0.15/$0.60
+			domain.Gpt35TurboModel, // $0.50/$1.50
+			domain.O3MiniModel,     // $1.10/$4.40
+		},
+		ImageModels: []string{
+			domain.DallE2Model,    // DALL-E 2
+			domain.DallE3Model,    // DALL-E 3
+			domain.GptImage1Model, // GPT Image 1, edits photos
+		},
+	}
+	if lister, ok := openAIClient.(llm.ModelLister); ok {
+		openAISource.Lister = lister
 	}
 
-	supportedImageModels := []string{
-		domain.DallE2Model,    // DALL-E 2
-		domain.DallE3Model,    // DALL-E 3
-		domain.FluxProUltra11, // Flux 1.1 Pro Ultra
+	catalogSources := []llm.CatalogSource{openAISource}
+
+	// Price per 1M tokens (Input/Output)
+	// https://www.anthropic.com/pricing#anthropic-api
+	if cfg.AnthropicToken != "" {
+		anthropicClient, err := anthropic.NewClient(cfg.AnthropicToken, cfg.AnthropicBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("creating anthropic client: %w", err)
+		}
+
+		catalogSources = append(catalogSources, llm.CatalogSource{
+			Provider: "anthropic",
+			Text:     anthropicClient,
+			Lister:   anthropicClient,
+			TextModels: []string{
+				domain.Claude35HaikuModel,  // $0.80/$4.00
+				domain.Claude37SonnetModel, // $3.00/$15.00
+			},
+		})
 	}
 
-	imageProviders := map[string]llm.ImageGenerator{
-		domain.DallE2Model:    openAIClient,
-		domain.DallE3Model:    openAIClient,
-		domain.FluxProUltra11: replicateClient,
+	// Price per 1M tokens (Input/Output)
+	// https://ai.google.dev/gemini-api/docs/pricing
+	if cfg.GeminiToken != "" {
+		geminiClient, err := gemini.NewClient(cfg.GeminiToken, cfg.GeminiBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("creating gemini client: %w", err)
+		}
+
+		catalogSources = append(catalogSources, llm.CatalogSource{
+			Provider: "gemini",
+			Text:     geminiClient,
+			Lister:   geminiClient,
+			TextModels: []string{
+				domain.Gemini20FlashModel, // $0.10/$0.40
+				domain.Gemini15ProModel,   // $1.25/$5.00
+			},
+		})
 	}
 
-	imageClient := llm.NewMultiProviderImageClient(imageProviders)
+	replicateSource := llm.CatalogSource{
+		Provider: "replicate",
+		Image:    replicateClient,
+		Editor:   replicateClient,
+		ImageModels: lo.Map(replicateModels, func(spec replicate.ModelSpec, _ int) string {
+			return spec.ID
+		}),
+	}
+	if lister, ok := replicateClient.(llm.ModelLister); ok {
+		replicateSource.Lister = lister
+	}
+	replicateSource.Submitter = replicateClient
+
+	catalogSources = append(catalogSources, replicateSource)
+
+	compatibleModels := map[string]string{}
+	for _, provider := range cfg.CompatibleProviders {
+		capabilities := domain.Capabilities{Tools: provider.Tools}
+		opts := []openai.Option{openai.WithCapabilities(capabilities)}
+		if provider.Tools {
+			opts = append(opts, openai.WithTools(toolRegistry))
+		}
+
+		compatibleClient, err := openai.NewCompatibleClient(provider.BaseURL, provider.Token, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s client: %w", provider.Name, err)
+		}
+
+		for _, model := range provider.Models {
+			if other, ok := compatibleModels[model]; ok {
+				return nil, fmt.Errorf("model %s of %s is already registered by %s", model, provider.Name, other)
+			}
+			compatibleModels[model] = provider.Name
+		}
+
+		catalogSources = append(catalogSources, llm.CatalogSource{
+			Provider:     provider.Name,
+			Text:         compatibleClient,
+			TextModels:   provider.Models,
+			Capabilities: capabilities,
+		})
+
+		slog.Info("registered openai-compatible provider", "name", provider.Name, "url", provider.BaseURL, "models", provider.Models)
+	}
+
+	catalog := llm.NewModelCatalog(catalogSources, llm.ModelFilter{
+		Allow: cfg.ModelsAllow,
+		Deny:  cfg.ModelsDeny,
+	})
+
+	textFallbacks, imageFallbacks, err := cfg.ModelFallbacks.split(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	textClient := llm.NewMultiProviderTextClient(catalog, textFallbacks)
+
+	var historyManager llm.HistoryManager = llm.NewHistoryTrimmer()
+	if cfg.HistorySummaryModel != "" {
+		if info, ok := catalog.Model(cfg.HistorySummaryModel); !ok || info.Kind != domain.ModelKindText {
+			return nil, fmt.Errorf("history summary model %s is not supported", cfg.HistorySummaryModel)
+		}
+		historyManager = llm.NewHistorySummarizer(textClient, cfg.HistorySummaryModel, cfg.HistorySummaryMaxTokens)
+	}
+
+	imageClient := llm.NewMultiProviderImageClient(catalog, imageFallbacks)
+	imageJobs := llm.NewBackgroundImageClient(catalog, imageClient, imageJobRepository)
+
+	if !lo.Contains([]domain.CapabilityPolicy{domain.CapabilityPolicyReject, domain.CapabilityPolicyReroute}, cfg.CapabilityPolicy) {
+		return nil, fmt.Errorf("unknown capability policy %s", cfg.CapabilityPolicy)
+	}
+	capabilityGuard := llm.NewCapabilityGuard(catalog, textFallbacks, cfg.CapabilityPolicy)
+
+	var intentClassifier llm.IntentClassifier
+	switch cfg.IntentClassifier {
+	case domain.IntentClassifierLLM:
+		intentClassifier = openAIClient
+	case domain.IntentClassifierKeywords:
+	default:
+		return nil, fmt.Errorf("unknown intent classifier %s", cfg.IntentClassifier)
+	}
+	intentRouter := llm.NewIntentRouter(intentClassifier)
 
 	supportedTTLOptions := []time.Duration{
 		30 * time.Second,
@@ -129,27 +389,48 @@ func setupServices(ctx context.Context) (services.Group, error) {
 		7 * 24 * time.Hour,
 	}
 
+	defaultQuota := domain.Quota{
+		Daily:   cfg.DailyUserLimit,
+		Monthly: cfg.MonthlyUserLimit,
+	}
+	quotaGuard := llm.NewQuotaGuard(quotaRepository, usageRepository, defaultQuota, cfg.MonthlyGlobalLimit)
+
 	opts := []bot.Option{
 		bot.WithMiddlewares(
 			middleware.RequestID,
 			middleware.Auth(cfg.TelegramAuthorizedUserIDs),
+			middleware.Usage(usageRepository),
+			middleware.Quota(quotaGuard),
 			middleware.Typing,
 			middleware.VoiceToText(&converter.VoiceToMP3{}, openAIClient),
 		),
 
-		bot.WithDefaultHandler(handlers.GenerateContent(chatRepository, promptRepository, openAIClient, imageClient, &converter.VoiceToMP3{})),
+		bot.WithDefaultHandler(handlers.GenerateContent(chatRepository, promptRepository, openAIClient, intentRouter, textClient, historyManager, capabilityGuard, imageJobs, &converter.VoiceToMP3{})),
 		bot.WithMessageTextHandler("/start", bot.MatchTypePrefix, handlers.Start()),
 		bot.WithMessageTextHandler("/new", bot.MatchTypePrefix, handlers.ClearChat(chatRepository)),
-		bot.WithMessageTextHandler("/text_models", bot.MatchTypePrefix, handlers.ShowTextModels(supportedTextModels)),
-		bot.WithMessageTextHandler("/image_models", bot.MatchTypePrefix, handlers.ShowImageModels(supportedImageModels)),
+		bot.WithMessageTextHandler("/text_models", bot.MatchTypePrefix, handlers.ShowTextModels(catalog)),
+		bot.WithMessageTextHandler("/image_models", bot.MatchTypePrefix, handlers.ShowImageModels(catalog)),
+		bot.WithMessageTextHandler("/image_settings", bot.MatchTypePrefix, handlers.ShowImageSettings(chatRepository)),
+		bot.WithMessageTextHandler("/queue", bot.MatchTypePrefix, handlers.ShowQueue(imageJobRepository)),
+		bot.WithMessageTextHandler("/prompts", bot.MatchTypePrefix, handlers.ShowPrompts(promptRepository)),
 		bot.WithMessageTextHandler("/system_prompt", bot.MatchTypePrefix, handlers.ShowSystemPrompt(chatRepository)),
 		bot.WithMessageTextHandler("/ttl", bot.MatchTypePrefix, handlers.ShowTTL(supportedTTLOptions)),
+		bot.WithMessageTextHandler("/reasoning", bot.MatchTypePrefix, handlers.ShowReasoning()),
+		bot.WithMessageTextHandler("/params", bot.MatchTypePrefix, handlers.ShowParams(chatRepository)),
+		bot.WithMessageTextHandler("/usage", bot.MatchTypePrefix, handlers.ShowUsage(usageRepository)),
+		bot.WithMessageTextHandler("/quota", bot.MatchTypePrefix, handlers.ManageQuota(quotaRepository, usageRepository, defaultQuota, cfg.TelegramAdminUserIDs)),
 
-		bot.WithCallbackQueryDataHandler(domain.SetImageModelCallbackPrefix, bot.MatchTypePrefix, handlers.SetImageModel(chatRepository, supportedImageModels)),
+		bot.WithCallbackQueryDataHandler(domain.SetImageModelCallbackPrefix, bot.MatchTypePrefix, handlers.SetImageModel(chatRepository, catalog)),
 		bot.WithCallbackQueryDataHandler(domain.SetTTLCallbackPrefix, bot.MatchTypePrefix, handlers.SetTTL(chatRepository, supportedTTLOptions)),
-		bot.WithCallbackQueryDataHandler(domain.SetTextModelCallbackPrefix, bot.MatchTypePrefix, handlers.SetTextModel(chatRepository, supportedTextModels)),
+		bot.WithCallbackQueryDataHandler(domain.SetTextModelCallbackPrefix, bot.MatchTypePrefix, handlers.SetTextModel(chatRepository, catalog)),
+		bot.WithCallbackQueryDataHandler(domain.SetReasoningCallbackPrefix, bot.MatchTypePrefix, handlers.SetReasoning(chatRepository)),
+		bot.WithCallbackQueryDataHandler(domain.SetParamCallbackPrefix, bot.MatchTypePrefix, handlers.SetParam(chatRepository)),
+		bot.WithCallbackQueryDataHandler(domain.SetImageSettingCallbackPrefix, bot.MatchTypePrefix, handlers.SetImageSetting(chatRepository)),
 		bot.WithCallbackQueryDataHandler(domain.SetSystemPromptCallbackPrefix, bot.MatchTypePrefix, handlers.RequestSystemPrompt(stateRepository)),
-		bot.WithCallbackQueryDataHandler(domain.GenImageCallbackPrefix, bot.MatchTypePrefix, handlers.RegenerateImage(promptRepository, imageClient, chatRepository)),
+		bot.WithCallbackQueryDataHandler(domain.GenImageCallbackPrefix, bot.MatchTypePrefix, handlers.RegenerateImage(promptRepository, imageJobs, chatRepository)),
+		bot.WithCallbackQueryDataHandler(domain.RedrawImageCallbackPrefix, bot.MatchTypePrefix, handlers.RedrawImage(imageRepository, promptRepository, imageJobs, chatRepository)),
+		bot.WithCallbackQueryDataHandler(domain.PromptsPageCallbackPrefix, bot.MatchTypePrefix, handlers.PagePrompts(promptRepository)),
+		bot.WithCallbackQueryDataHandler(domain.UpscaleImageCallbackPrefix, bot.MatchTypePrefix, handlers.UpscaleImage(imageRepository, imageJobs)),
 	}
 
 	b, err := bot.New(cfg.TelegramBotToken, opts...)
@@ -165,5 +446,27 @@ func setupServices(ctx context.Context) (services.Group, error) {
 		return nil, err
 	}
 
+	if svc, err = services.NewModelCatalog(catalog, cfg.ModelCatalogRefresh); err == nil {
+		svcGroup = append(svcGroup, svc)
+	} else {
+		return nil, err
+	}
+
+	imageDelivery := handlers.NewImageDelivery(b, imageRepository)
+
+	if svc, err = services.NewImageQueue(cfg.ImageWorkers, cfg.ImageQueuePollInterval, imageJobRepository, imageJobs, replicateClient, replicateClient, promptRepository, imageDelivery, quotaGuard, imageDelivery, usageRepository); err == nil {
+		svcGroup = append(svcGroup, svc)
+	} else {
+		return nil, err
+	}
+
+	if cfg.ReplicateWebhookURL != "" {
+		if svc, err = services.NewReplicateWebhook(cfg.WebhookAddr, replicateClient, imageJobRepository, imageDelivery, usageRepository); err == nil {
+			svcGroup = append(svcGroup, svc)
+		} else {
+			return nil, err
+		}
+	}
+
 	return svcGroup, nil
 }
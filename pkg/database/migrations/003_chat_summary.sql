@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE chats ADD COLUMN summary TEXT;
\ No newline at end of file
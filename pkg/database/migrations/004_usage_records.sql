@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE usage_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    user_name VARCHAR(255),
+    chat_id BIGINT NOT NULL,
+    topic_id INTEGER NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    audio_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    images INTEGER NOT NULL DEFAULT 0,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_usage_records_created_at
+    ON usage_records (created_at);
\ No newline at end of file
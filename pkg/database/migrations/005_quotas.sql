@@ -0,0 +1,7 @@
+-- +migrate Up
+CREATE TABLE quotas (
+    user_id BIGINT PRIMARY KEY,
+    daily DOUBLE PRECISION NOT NULL DEFAULT 0,
+    monthly DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE chats ADD COLUMN reasoning VARCHAR(10);
\ No newline at end of file
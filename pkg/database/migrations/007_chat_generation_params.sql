@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE chats
+    ADD COLUMN temperature DOUBLE PRECISION,
+    ADD COLUMN top_p DOUBLE PRECISION,
+    ADD COLUMN max_tokens INTEGER,
+    ADD COLUMN presence_penalty DOUBLE PRECISION,
+    ADD COLUMN frequency_penalty DOUBLE PRECISION;
\ No newline at end of file
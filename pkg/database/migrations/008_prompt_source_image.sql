@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE prompts ADD COLUMN source_file_id TEXT;
\ No newline at end of file
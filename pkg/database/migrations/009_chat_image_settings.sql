@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE chats
+    ADD COLUMN image_aspect_ratio VARCHAR(16),
+    ADD COLUMN image_size VARCHAR(16),
+    ADD COLUMN image_quality VARCHAR(16);
\ No newline at end of file
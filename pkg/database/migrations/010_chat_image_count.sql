@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE chats ADD COLUMN image_count INTEGER;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE TABLE generated_images (
+    id BIGSERIAL PRIMARY KEY,
+    prompt_id INTEGER NOT NULL REFERENCES prompts (id),
+    chat_id BIGINT NOT NULL,
+    file_id TEXT NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
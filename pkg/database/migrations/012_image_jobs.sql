@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE image_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    user_name VARCHAR(255) NOT NULL,
+    chat_id BIGINT NOT NULL,
+    topic_id INTEGER NOT NULL,
+    prompt_id INTEGER NOT NULL REFERENCES prompts (id),
+    model VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+CREATE TABLE image_predictions (
+    id VARCHAR(255) PRIMARY KEY,
+    job_id BIGINT NOT NULL REFERENCES image_jobs (id),
+    output JSONB,
+    error TEXT,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_image_predictions_job_id
+    ON image_predictions (job_id);
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- +migrate Up
+ALTER TABLE image_jobs
+    ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'draw',
+    ADD COLUMN source_file_id VARCHAR(255),
+    ADD COLUMN image_aspect_ratio VARCHAR(16),
+    ADD COLUMN image_size VARCHAR(16),
+    ADD COLUMN image_quality VARCHAR(16),
+    ADD COLUMN image_count INTEGER,
+    ADD COLUMN started_at TIMESTAMP;
+
+CREATE INDEX idx_image_jobs_status
+    ON image_jobs (status, id);
+
+CREATE TABLE image_job_images (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT NOT NULL REFERENCES image_jobs (id),
+    model VARCHAR(255) NOT NULL,
+    data BYTEA NOT NULL
+);
+
+CREATE INDEX idx_image_job_images_job_id
+    ON image_job_images (job_id);
\ No newline at end of file
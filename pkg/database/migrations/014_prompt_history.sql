@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE prompts
+    ADD COLUMN chat_id BIGINT,
+    ADD COLUMN topic_id INTEGER,
+    ADD COLUMN user_id BIGINT,
+    ADD COLUMN model VARCHAR(255),
+    ADD COLUMN created_at TIMESTAMP;
+
+CREATE INDEX prompts_chat_idx ON prompts (chat_id, topic_id, id);
\ No newline at end of file
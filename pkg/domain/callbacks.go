@@ -6,4 +6,10 @@ const (
 	SetTextModelCallbackPrefix    = "textmodel_"
 	SetImageModelCallbackPrefix   = "imgmodel_"
 	SetSystemPromptCallbackPrefix = "systemprompt_"
+	SetReasoningCallbackPrefix    = "reasoning_"
+	SetParamCallbackPrefix        = "params_"
+	SetImageSettingCallbackPrefix = "imgset_"
+	RedrawImageCallbackPrefix     = "imgredraw_"
+	UpscaleImageCallbackPrefix    = "upscale_"
+	PromptsPageCallbackPrefix     = "prompts_"
 )
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Capability string
+
+const (
+	CapabilityVision    Capability = "vision"
+	CapabilityTools     Capability = "tools"
+	CapabilityJSONMode  Capability = "json_mode"
+	CapabilityStreaming Capability = "streaming"
+	CapabilityContext   Capability = "context" // Context long enough for the request
+)
+
+// CapabilityTitles names the capabilities for users.
+var CapabilityTitles = map[Capability]string{
+	CapabilityVision:    "понимание изображений",
+	CapabilityTools:     "вызов инструментов",
+	CapabilityJSONMode:  "ответы в JSON",
+	CapabilityStreaming: "потоковые ответы",
+	CapabilityContext:   "длинный контекст",
+}
+
+// Capabilities tells what a model can handle.
+type Capabilities struct {
+	Vision     bool // Understands images in the chat
+	Tools      bool // Calls functions
+	JSONMode   bool // Answers with valid JSON when asked to
+	Streaming  bool // Delivers answers incrementally
+	MaxContext int  // Tokens of prompt and completion together
+}
+
+// Requirements is what a request needs from the model answering it.
+type Requirements struct {
+	Capabilities []Capability
+	Context      int // Tokens the request takes at least, including the answer
+}
+
+// Missing returns the requirements the model can't meet.
+func (c Capabilities) Missing(r Requirements) []Capability {
+	var missing []Capability
+	for _, capability := range r.Capabilities {
+		if !c.Has(capability) {
+			missing = append(missing, capability)
+		}
+	}
+	if r.Context > c.MaxContext {
+		missing = append(missing, CapabilityContext)
+	}
+	return missing
+}
+
+func (c Capabilities) Has(capability Capability) bool {
+	switch capability {
+	case CapabilityVision:
+		return c.Vision
+	case CapabilityTools:
+		return c.Tools
+	case CapabilityJSONMode:
+		return c.JSONMode
+	case CapabilityStreaming:
+		return c.Streaming
+	default:
+		return false
+	}
+}
+
+// Merge adds the capabilities of other. The larger context wins.
+func (c Capabilities) Merge(other Capabilities) Capabilities {
+	return Capabilities{
+		Vision:     c.Vision || other.Vision,
+		Tools:      c.Tools || other.Tools,
+		JSONMode:   c.JSONMode || other.JSONMode,
+		Streaming:  c.Streaming || other.Streaming,
+		MaxContext: max(c.MaxContext, other.MaxContext),
+	}
+}
+
+// Families of text models by capability, matched by ID prefix. Exceptions to a family
+// are listed separately.
+var (
+	visionModelPrefixes = []string{
+		"gpt-4o", "gpt-4.1", "gpt-4-turbo", "chatgpt-4o", "o1", "o3", "o4-mini",
+		"claude-3", "claude-sonnet-4", "claude-opus-4", "gemini-",
+	}
+	visionlessModels = []string{"o1-mini", "o3-mini"}
+
+	toolModelPrefixes = []string{
+		"gpt-4", "gpt-3.5-turbo", "o1", "o3", "o4-mini", "claude-", "gemini-",
+	}
+	toollessModels = []string{"o1-mini", "chatgpt-4o"}
+
+	jsonModeModelPrefixes = []string{
+		"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-3.5-turbo", "chatgpt-4o", "o1", "o3", "o4-mini", "gemini-",
+	}
+	jsonModelessModels = []string{"o1-mini"}
+
+	// Answered in one piece only
+	streamlessModels = []string{"o1-pro", "o3-pro"}
+)
+
+// CapabilitiesOf returns what is known about the capabilities of the text model.
+// Models are assumed to stream unless known not to.
+func CapabilitiesOf(model string) Capabilities {
+	return Capabilities{
+		Vision:     inFamily(model, visionModelPrefixes, visionlessModels),
+		Tools:      inFamily(model, toolModelPrefixes, toollessModels),
+		JSONMode:   inFamily(model, jsonModeModelPrefixes, jsonModelessModels),
+		Streaming:  inFamily(model, []string{""}, streamlessModels),
+		MaxContext: ContextWindow(model),
+	}
+}
+
+func inFamily(model string, prefixes, exceptions []string) bool {
+	for _, m := range exceptions {
+		if model == m || strings.HasPrefix(model, m+"-") {
+			return false
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CapabilityPolicy decides what happens to requests the chat model can't handle.
+type CapabilityPolicy string
+
+const (
+	CapabilityPolicyReject  CapabilityPolicy = "reject"  // Tell the user to pick another model
+	CapabilityPolicyReroute CapabilityPolicy = "reroute" // Answer with a capable model this time
+)
+
+var ErrIncapableModel = errors.New("model can't handle the request")
+
+// IncapableModelError tells which requirements of a request the model can't meet.
+type IncapableModelError struct {
+	Model   string
+	Missing []Capability
+}
+
+func (e *IncapableModelError) Error() string {
+	return fmt.Sprintf("model %s lacks %v", e.Model, e.Missing)
+}
+
+func (e *IncapableModelError) Unwrap() error {
+	return ErrIncapableModel
+}
@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
 
 const DefaultTTL = 15 * time.Minute
 
@@ -11,8 +15,20 @@ type Chat struct {
 	ImageModel   string
 	TTL          time.Duration
 	SystemPrompt string
-	Messages     []Message
-	LastUpdate   time.Time
+	Summary      string // Gist of the turns compressed out of Messages
+	Reasoning    string // Reasoning effort of reasoning models, empty for the provider default
+
+	ImageSettings ImageSettings `bun:"embed:image_"`
+
+	// Generation parameters, nil or zero for the provider defaults
+	Temperature      *float64
+	TopP             *float64 `bun:"top_p"`
+	MaxTokens        int
+	PresencePenalty  *float64
+	FrequencyPenalty *float64
+
+	Messages   []Message
+	LastUpdate time.Time
 }
 
 func NewChat(chatID int64, topicID int) *Chat {
@@ -25,12 +41,39 @@ func NewChat(chatID int64, topicID int) *Chat {
 	}
 }
 
+// Instructions returns the system prompt along with the summary of earlier turns, if any.
+func (c *Chat) Instructions() string {
+	if c.Summary == "" {
+		return c.SystemPrompt
+	}
+
+	summary := "Summary of the earlier conversation:\n" + c.Summary
+	if c.SystemPrompt == "" {
+		return summary
+	}
+
+	return c.SystemPrompt + "\n\n" + summary
+}
+
 type Message struct {
 	Role         string
 	ContentParts []ContentPart
+	ToolCalls    []ToolCall `json:",omitempty"` // Tools the assistant asked to run
+	ToolCallID   string     `json:",omitempty"` // Call answered by a tool message
+	Model        string     `json:",omitempty"` // Model that wrote an assistant message
 }
 
-const MessageRoleUser = "user"
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+	MessageRoleTool      = "tool"
+)
+
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON encoded arguments
+}
 
 type ContentPart struct {
 	Type ContentPartType
@@ -43,3 +86,19 @@ const (
 	ContentPartTypeText  ContentPartType = "text"
 	ContentPartTypeImage ContentPartType = "image"
 )
+
+// ParseDataURL splits a base64 encoded data URL of an image content part
+// into its media type and payload.
+func ParseDataURL(dataURL string) (string, string, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !ok || !strings.HasPrefix(dataURL, "data:") {
+		return "", "", errors.New("malformed data URL")
+	}
+
+	mediaType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", "", errors.New("data URL is not base64 encoded")
+	}
+
+	return mediaType, data, nil
+}
@@ -0,0 +1,108 @@
+package domain
+
+import "math"
+
+// GenerationParam is a generation parameter users may tune per chat. Unset
+// parameters are left to the provider defaults.
+type GenerationParam struct {
+	Key     string // Identifies the parameter in callback data
+	Title   string
+	Min     float64
+	Max     float64
+	Step    float64 // Added or subtracted on every change
+	Factor  float64 // Multiplies or divides on every change instead of Step, if set
+	Default float64 // Provider default the first change starts from
+
+	get func(c *Chat) *float64
+	set func(c *Chat, v *float64)
+}
+
+// GenerationParams lists the tunable parameters in the order they are shown.
+var GenerationParams = []GenerationParam{
+	{
+		Key: "temperature", Title: "Temperature", Min: 0, Max: 2, Step: 0.1, Default: 1,
+		get: func(c *Chat) *float64 { return c.Temperature },
+		set: func(c *Chat, v *float64) { c.Temperature = v },
+	},
+	{
+		Key: "top_p", Title: "Top P", Min: 0, Max: 1, Step: 0.05, Default: 1,
+		get: func(c *Chat) *float64 { return c.TopP },
+		set: func(c *Chat, v *float64) { c.TopP = v },
+	},
+	{
+		Key: "max_tokens", Title: "Max tokens", Min: 256, Max: 16384, Factor: 2, Default: 4096,
+		get: func(c *Chat) *float64 {
+			if c.MaxTokens == 0 {
+				return nil
+			}
+			v := float64(c.MaxTokens)
+			return &v
+		},
+		set: func(c *Chat, v *float64) {
+			c.MaxTokens = 0
+			if v != nil {
+				c.MaxTokens = int(*v)
+			}
+		},
+	},
+	{
+		Key: "presence_penalty", Title: "Presence penalty", Min: -2, Max: 2, Step: 0.1, Default: 0,
+		get: func(c *Chat) *float64 { return c.PresencePenalty },
+		set: func(c *Chat, v *float64) { c.PresencePenalty = v },
+	},
+	{
+		Key: "frequency_penalty", Title: "Frequency penalty", Min: -2, Max: 2, Step: 0.1, Default: 0,
+		get: func(c *Chat) *float64 { return c.FrequencyPenalty },
+		set: func(c *Chat, v *float64) { c.FrequencyPenalty = v },
+	},
+}
+
+// GenerationParamByKey looks up a tunable parameter.
+func GenerationParamByKey(key string) (GenerationParam, bool) {
+	for _, p := range GenerationParams {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return GenerationParam{}, false
+}
+
+// Value returns the value set in the chat, or false if the provider default applies.
+func (p GenerationParam) Value(c *Chat) (float64, bool) {
+	v := p.get(c)
+	if v == nil {
+		return 0, false
+	}
+	return *v, true
+}
+
+// Change moves the value of the chat one step up or down within the limits.
+// An unset value starts from the provider default.
+func (p GenerationParam) Change(c *Chat, up bool) {
+	v, ok := p.Value(c)
+	if !ok {
+		v = p.Default
+	}
+
+	switch {
+	case p.Factor != 0 && up:
+		v *= p.Factor
+	case p.Factor != 0:
+		v /= p.Factor
+	case up:
+		v += p.Step
+	default:
+		v -= p.Step
+	}
+
+	// Round away the float error accumulated by the steps
+	v = math.Round(v*100) / 100
+	v = min(max(v, p.Min), p.Max)
+
+	p.set(c, &v)
+}
+
+// Reset returns the parameter of the chat to the provider default.
+func (p GenerationParam) Reset(c *Chat) {
+	p.set(c, nil)
+}
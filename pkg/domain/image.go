@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+const RealESRGANModel = "real-esrgan"
+
+// Image is a generated image along with the model that drew it.
+type Image struct {
+	Data  []byte
+	Model string
+}
+
+// GeneratedImage is an image sent to a chat, kept to redraw or upscale it later.
+type GeneratedImage struct {
+	ID        int64 `bun:",pk,autoincrement"`
+	PromptID  int
+	ChatID    int64  // Chat the photo was sent to, its buttons only work there
+	FileID    string // Telegram file of the sent photo
+	Model     string
+	CreatedAt time.Time
+}
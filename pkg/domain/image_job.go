@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type ImageJobStatus string
+
+const (
+	ImageJobStatusQueued     ImageJobStatus = "queued"     // Waiting for a worker
+	ImageJobStatusRunning    ImageJobStatus = "running"    // Drawn by a worker
+	ImageJobStatusSubmitting ImageJobStatus = "submitting" // Submitting predictions drawing in the background
+	ImageJobStatusPending    ImageJobStatus = "pending"    // Awaiting the predictions
+	ImageJobStatusDelivering ImageJobStatus = "delivering" // Sending the outcome to the chat
+	ImageJobStatusSucceeded  ImageJobStatus = "succeeded"
+	ImageJobStatusFailed     ImageJobStatus = "failed"
+)
+
+type ImageJobKind string
+
+const (
+	ImageJobKindDraw    ImageJobKind = "draw"    // Draws the prompt, editing the source file if any
+	ImageJobKindUpscale ImageJobKind = "upscale" // Enlarges the source file
+)
+
+// ImageJob is a request to draw images, kept until the images reach the chat that asked
+// for them, so that neither a restart nor a slow model loses it.
+type ImageJob struct {
+	ID           int64 `bun:",pk,autoincrement"`
+	Kind         ImageJobKind
+	UserID       int64 // Who pays for the images
+	UserName     string
+	ChatID       int64
+	TopicID      int
+	PromptID     int
+	Prompt       *Prompt `bun:"rel:belongs-to,join:prompt_id=id"`
+	SourceFileID string  `bun:",nullzero"` // Telegram file of the image to edit or upscale
+	Model        string
+	Settings     ImageSettings `bun:"embed:image_"`
+	Status       ImageJobStatus
+	Error        string `bun:",nullzero"`
+	Position     int    `bun:",scanonly"` // Place in the queue, for queued jobs only
+	CreatedAt    time.Time
+	StartedAt    time.Time `bun:",nullzero"`
+	CompletedAt  time.Time `bun:",nullzero"`
+
+	Predictions []ImagePrediction `bun:"rel:has-many,join:id=job_id"`
+	Images      []ImageJobImage   `bun:"rel:has-many,join:id=job_id"` // Kept while delivering
+}
+
+// Completed reports whether all predictions of the job completed.
+func (j *ImageJob) Completed() bool {
+	for _, p := range j.Predictions {
+		if p.CompletedAt.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// ImageJobImage is an image drawn by a job, kept until it reaches the chat, so that
+// a failed delivery is retried without drawing the image again.
+type ImageJobImage struct {
+	ID    int64 `bun:",pk,autoincrement"`
+	JobID int64
+	Model string
+	Data  []byte
+}
+
+// ImagePrediction is a prediction drawing images of a job, with its outcome once the
+// provider posts it.
+type ImagePrediction struct {
+	ID          string `bun:",pk"`
+	JobID       int64
+	Output      json.RawMessage `bun:"type:jsonb,nullzero"`
+	Error       string          `bun:",nullzero"`
+	CompletedAt time.Time       `bun:",nullzero"`
+}
+
+// Prediction is the outcome of a background prediction, as posted by its provider.
+type Prediction struct {
+	ID     string
+	Done   bool   // Whether the prediction succeeded, failed or was canceled
+	Output []byte // Raw, in the shape of the model
+	Err    error  // Why the prediction failed, if it did
+}
+
+// Complete records the outcome of the posted prediction.
+func (p *ImagePrediction) Complete(prediction *Prediction) {
+	p.Output = prediction.Output
+	if prediction.Err != nil {
+		p.Error = prediction.Err.Error()
+	}
+	p.CompletedAt = time.Now()
+}
+
+// Prediction returns the outcome recorded of the prediction.
+func (p *ImagePrediction) Prediction() *Prediction {
+	prediction := &Prediction{
+		ID:     p.ID,
+		Done:   !p.CompletedAt.IsZero(),
+		Output: p.Output,
+	}
+	if p.Error != "" {
+		prediction.Err = errors.New(p.Error)
+	}
+	return prediction
+}
@@ -1,7 +1,20 @@
 package domain
 
+import "slices"
+
 const (
 	DallE2Model    = "dall-e-2"
 	DallE3Model    = "dall-e-3"
+	GptImage1Model = "gpt-image-1"
 	FluxProUltra11 = "flux-1.1-pro-ultra"
+	FluxKontextPro = "flux-kontext-pro"
 )
+
+// editingModels can redraw a given image. DALL-E 2 is left out, as it only
+// edits square PNGs whose transparent areas mark what to redraw.
+var editingModels = []string{GptImage1Model, FluxKontextPro}
+
+// CanEditImages reports whether the image model is known to redraw given images.
+func CanEditImages(model string) bool {
+	return slices.Contains(editingModels, model)
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	ImageSizeSmall  = "small"
+	ImageSizeMedium = "medium"
+	ImageSizeLarge  = "large"
+
+	ImageQualityStandard = "standard"
+	ImageQualityHD       = "hd"
+
+	MaxImageCount = 4
+)
+
+// ImageSettings are what a chat prefers for drawn images. Providers map them to the
+// nearest values their models support, empty values leave the model defaults.
+type ImageSettings struct {
+	AspectRatio string // Width to height, e.g. "16:9"
+	Size        string
+	Quality     string
+	Count       int // Images drawn per request, 0 for one
+}
+
+// ImageCount returns how many images to draw per request.
+func (s ImageSettings) ImageCount() int {
+	return min(max(s.Count, 1), MaxImageCount)
+}
+
+// Orientation returns 1 for landscape, -1 for portrait and 0 for square or unset aspect ratios.
+func (s ImageSettings) Orientation() int {
+	width, height, ok := s.Ratio()
+	switch {
+	case !ok || width == height:
+		return 0
+	case width > height:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// Ratio parses the aspect ratio, or returns false if it is unset or malformed.
+func (s ImageSettings) Ratio() (int, int, bool) {
+	w, h, ok := strings.Cut(s.AspectRatio, ":")
+	if !ok {
+		return 0, 0, false
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return 0, 0, false
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return 0, 0, false
+	}
+
+	return width, height, true
+}
+
+// ImageSettingOption is a value users may pick for an image setting.
+type ImageSettingOption struct {
+	Value string
+	Title string
+}
+
+// ImageSetting is an image setting users may change per chat.
+type ImageSetting struct {
+	Key     string // Identifies the setting in callback data
+	Title   string
+	Options []ImageSettingOption
+
+	get func(s *ImageSettings) string
+	set func(s *ImageSettings, v string)
+}
+
+// ImageSettingsMenu lists the image settings in the order they are shown.
+var ImageSettingsMenu = []ImageSetting{
+	{
+		Key: "aspect", Title: "Формат",
+		Options: []ImageSettingOption{
+			{Value: "1:1", Title: "1:1"},
+			{Value: "3:2", Title: "3:2"},
+			{Value: "2:3", Title: "2:3"},
+			{Value: "16:9", Title: "16:9"},
+			{Value: "9:16", Title: "9:16"},
+		},
+		get: func(s *ImageSettings) string { return s.AspectRatio },
+		set: func(s *ImageSettings, v string) { s.AspectRatio = v },
+	},
+	{
+		Key: "size", Title: "Размер",
+		Options: []ImageSettingOption{
+			{Value: ImageSizeSmall, Title: "Маленький"},
+			{Value: ImageSizeMedium, Title: "Средний"},
+			{Value: ImageSizeLarge, Title: "Большой"},
+		},
+		get: func(s *ImageSettings) string { return s.Size },
+		set: func(s *ImageSettings, v string) { s.Size = v },
+	},
+	{
+		Key: "quality", Title: "Качество",
+		Options: []ImageSettingOption{
+			{Value: ImageQualityStandard, Title: "Стандарт"},
+			{Value: ImageQualityHD, Title: "HD"},
+		},
+		get: func(s *ImageSettings) string { return s.Quality },
+		set: func(s *ImageSettings, v string) { s.Quality = v },
+	},
+	{
+		Key: "count", Title: "Количество",
+		Options: []ImageSettingOption{
+			{Value: "1", Title: "1"},
+			{Value: "2", Title: "2"},
+			{Value: "3", Title: "3"},
+			{Value: "4", Title: "4"},
+		},
+		get: func(s *ImageSettings) string {
+			if s.Count == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.Count)
+		},
+		set: func(s *ImageSettings, v string) { s.Count, _ = strconv.Atoi(v) },
+	},
+}
+
+// ImageSettingByKey looks up an image setting.
+func ImageSettingByKey(key string) (ImageSetting, bool) {
+	for _, setting := range ImageSettingsMenu {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return ImageSetting{}, false
+}
+
+// Value returns the option picked in the settings, empty for the model default.
+func (s ImageSetting) Value(settings *ImageSettings) string {
+	return s.get(settings)
+}
+
+// Set picks an option of the setting, or the model default for an empty value.
+// It reports false if the setting has no such option.
+func (s ImageSetting) Set(settings *ImageSettings, value string) bool {
+	if value != "" && !slices.ContainsFunc(s.Options, func(o ImageSettingOption) bool { return o.Value == value }) {
+		return false
+	}
+	s.set(settings, value)
+	return true
+}
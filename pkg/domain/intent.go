@@ -0,0 +1,44 @@
+package domain
+
+import "slices"
+
+// Intent is what the user wants the bot to do with a message.
+type Intent string
+
+const (
+	IntentChat            Intent = "chat"
+	IntentImageGeneration Intent = "image_generation"
+	IntentImageEdit       Intent = "image_edit"
+	IntentTranscription   Intent = "transcription"
+)
+
+// Intents lists the intents the bot can handle, the default one first.
+var Intents = []Intent{IntentChat, IntentImageGeneration, IntentImageEdit, IntentTranscription}
+
+// IntentRequest is a message to classify along with what it comes with.
+type IntentRequest struct {
+	Text     string
+	HasImage bool // A photo is sent along or replied to
+	HasVoice bool // A voice message is replied to
+}
+
+// Allows reports whether the intent can be carried out for the request: an image
+// can only be edited and a voice message transcribed if there is one.
+func (r IntentRequest) Allows(intent Intent) bool {
+	switch intent {
+	case IntentImageEdit:
+		return r.HasImage
+	case IntentTranscription:
+		return r.HasVoice
+	default:
+		return slices.Contains(Intents, intent)
+	}
+}
+
+// IntentClassifierKind decides how the intents of messages are recognized.
+type IntentClassifierKind string
+
+const (
+	IntentClassifierLLM      IntentClassifierKind = "llm"      // Ask a cheap model, fall back to keywords
+	IntentClassifierKeywords IntentClassifierKind = "keywords" // Look for keywords only
+)
@@ -0,0 +1,54 @@
+package domain
+
+type ModelKind string
+
+const (
+	ModelKindText  ModelKind = "text"
+	ModelKindImage ModelKind = "image"
+)
+
+// ModelInfo describes a model served by one of the providers.
+type ModelInfo struct {
+	ID        string
+	Name      string // Human readable name, the ID if the provider has none
+	Provider  string
+	Kind      ModelKind
+	Reasoning bool
+	Editing   bool // Redraws given images, for image models
+	Price     Price
+	Capabilities
+}
+
+// modelNames holds the names of models whose providers don't report one.
+var modelNames = map[string]string{
+	DallE2Model:    "DALL-E 2",
+	DallE3Model:    "DALL-E 3",
+	GptImage1Model: "GPT Image 1",
+	FluxProUltra11: "Flux 1.1 Pro Ultra",
+	FluxKontextPro: "Flux Kontext Pro",
+}
+
+// Enrich fills in what is known about the model but was not reported by its provider.
+func (m ModelInfo) Enrich() ModelInfo {
+	if m.Name == "" {
+		m.Name = modelNames[m.ID]
+	}
+	if m.Name == "" {
+		m.Name = m.ID
+	}
+
+	if m.Price == (Price{}) {
+		m.Price = PriceOf(m.ID)
+	}
+
+	if m.Kind == ModelKindText {
+		m.Reasoning = m.Reasoning || IsReasoningModel(m.ID)
+		m.Capabilities = m.Capabilities.Merge(CapabilitiesOf(m.ID))
+	}
+
+	if m.Kind == ModelKindImage {
+		m.Editing = m.Editing || CanEditImages(m.ID)
+	}
+
+	return m
+}
@@ -0,0 +1,108 @@
+package domain
+
+import "maps"
+
+const WhisperModel = "whisper-1"
+
+// Price is the list price of a model in USD.
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`  // Per 1M input tokens
+	OutputPerMillion float64 `json:"output_per_million"` // Per 1M output tokens
+	PerImage         float64 `json:"per_image"`
+	PerMinute        float64 `json:"per_minute"` // Per minute of audio
+}
+
+// prices of the supported models.
+// https://platform.openai.com/docs/pricing
+// https://www.anthropic.com/pricing#anthropic-api
+// https://ai.google.dev/gemini-api/docs/pricing
+// https://replicate.com/pricing
+var prices = map[string]Price{
+	Gpt4oMiniModel:      {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	Gpt35TurboModel:     {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	O3MiniModel:         {InputPerMillion: 1.10, OutputPerMillion: 4.40},
+	Claude35HaikuModel:  {InputPerMillion: 0.80, OutputPerMillion: 4.00},
+	Claude37SonnetModel: {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	Gemini20FlashModel:  {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	Gemini15ProModel:    {InputPerMillion: 1.25, OutputPerMillion: 5.00},
+
+	DallE2Model:    {PerImage: 0.016}, // 256x256
+	DallE3Model:    {PerImage: 0.08},  // 1024x1024 HD
+	GptImage1Model: {PerImage: 0.042}, // 1024x1024 medium quality
+	FluxProUltra11: {PerImage: 0.06},
+	FluxKontextPro: {PerImage: 0.04},
+
+	RealESRGANModel: {PerImage: 0.002},
+
+	WhisperModel: {PerMinute: 0.006},
+}
+
+// SetPrices adds prices to the table above or replaces the listed ones, e.g. to
+// price newly released models. It must be called before any price is looked up.
+func SetPrices(overrides map[string]Price) {
+	maps.Copy(prices, overrides)
+}
+
+// PriceOf returns the price of the model. Unknown models, e.g. self-hosted ones, are free.
+func PriceOf(model string) Price {
+	return prices[model]
+}
+
+type imageOptions struct {
+	size    string
+	quality string
+}
+
+// imagePrices of the models priced by the size and quality of the image, as sent to
+// the provider.
+// https://platform.openai.com/docs/pricing#image-generation
+var imagePrices = map[string]map[imageOptions]float64{
+	DallE2Model: {
+		{"256x256", "standard"}:   0.016,
+		{"512x512", "standard"}:   0.018,
+		{"1024x1024", "standard"}: 0.02,
+	},
+	DallE3Model: {
+		{"1024x1024", "standard"}: 0.04,
+		{"1024x1792", "standard"}: 0.08,
+		{"1792x1024", "standard"}: 0.08,
+		{"1024x1024", "hd"}:       0.08,
+		{"1024x1792", "hd"}:       0.12,
+		{"1792x1024", "hd"}:       0.12,
+	},
+	GptImage1Model: {
+		{"1024x1024", "low"}:    0.011,
+		{"1024x1536", "low"}:    0.016,
+		{"1536x1024", "low"}:    0.016,
+		{"1024x1024", "medium"}: 0.042,
+		{"1024x1536", "medium"}: 0.063,
+		{"1536x1024", "medium"}: 0.063,
+		{"1024x1024", "high"}:   0.167,
+		{"1024x1536", "high"}:   0.25,
+		{"1536x1024", "high"}:   0.25,
+	},
+}
+
+// ImagePriceOf returns the price of an image the model draws in the size and quality.
+// Models priced the same for all images cost PerImage.
+func ImagePriceOf(model, size, quality string) float64 {
+	if price, ok := imagePrices[model][imageOptions{size: size, quality: quality}]; ok {
+		return price
+	}
+	return PriceOf(model).PerImage
+}
+
+func (p Price) Cost(u Usage) float64 {
+	const million = 1_000_000
+	const secondsPerMinute = 60
+
+	imagePrice := p.PerImage
+	if u.ImagePrice > 0 {
+		imagePrice = u.ImagePrice
+	}
+
+	return float64(u.InputTokens)*p.InputPerMillion/million +
+		float64(u.OutputTokens)*p.OutputPerMillion/million +
+		float64(u.Images)*imagePrice +
+		u.AudioSeconds*p.PerMinute/secondsPerMinute
+}
@@ -1,8 +1,16 @@
 package domain
 
+import "time"
+
 type Prompt struct {
-	ID         int    `bun:",pk,autoincrement"`
-	Text       string `bun:"text"`
-	ImageBytes []byte `bun:"-"`
-	AudioBytes []byte `bun:"-"`
+	ID           int       `bun:",pk,autoincrement"`
+	Text         string    `bun:"text"`
+	SourceFileID string    `bun:"source_file_id,nullzero"` // Telegram file of the photo to edit, empty to draw from scratch
+	ChatID       int64     `bun:"chat_id,nullzero"`
+	TopicID      int       `bun:"topic_id"`
+	UserID       int64     `bun:"user_id,nullzero"` // Who asked to draw the prompt
+	Model        string    `bun:"model,nullzero"`   // Image model the prompt was first drawn with
+	CreatedAt    time.Time `bun:"created_at,nullzero"`
+	ImageBytes   []byte    `bun:"-"`
+	AudioBytes   []byte    `bun:"-"`
 }
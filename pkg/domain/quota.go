@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Quota limits how much a user may spend on models, in USD. Zero means no limit.
+type Quota struct {
+	bun.BaseModel `bun:"table:quotas"`
+
+	UserID    int64 `bun:",pk"`
+	Daily     float64
+	Monthly   float64
+	UpdatedAt time.Time
+}
+
+// StartOfDay returns the beginning of the UTC day, when daily quotas reset.
+func StartOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfMonth returns the beginning of the UTC month, when monthly quotas reset.
+func StartOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// QuotaScope tells whose spend a limit caps and how often it resets.
+type QuotaScope string
+
+const (
+	QuotaScopeDaily   QuotaScope = "daily"
+	QuotaScopeMonthly QuotaScope = "monthly"
+	QuotaScopeGlobal  QuotaScope = "global" // Monthly spend of all users together
+)
+
+// QuotaScopeTitles names the limits for users.
+var QuotaScopeTitles = map[QuotaScope]string{
+	QuotaScopeDaily:   "Ваш дневной лимит",
+	QuotaScopeMonthly: "Ваш месячный лимит",
+	QuotaScopeGlobal:  "Общий месячный лимит бота",
+}
+
+var ErrQuotaExhausted = errors.New("spending quota exhausted")
+
+// QuotaExhaustedError tells which limit a user has spent and when it resets.
+type QuotaExhaustedError struct {
+	Scope QuotaScope
+	Spent float64
+	Limit float64
+	Reset time.Time
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("%s quota exhausted: $%.2f of $%.2f", e.Scope, e.Spent, e.Limit)
+}
+
+func (e *QuotaExhaustedError) Unwrap() error {
+	return ErrQuotaExhausted
+}
@@ -1,5 +1,88 @@
 package domain
 
+import "strings"
+
 const (
-	Gpt4oMiniModel = "gpt-4o-mini"
+	Gpt4oMiniModel  = "gpt-4o-mini"
+	Gpt35TurboModel = "gpt-3.5-turbo"
+	Gpt4oModel      = "gpt-4o"
+	Gpt4TurboModel  = "gpt-4-turbo"
+	O3MiniModel     = "o3-mini"
+
+	Claude35HaikuModel  = "claude-3-5-haiku-latest"
+	Claude37SonnetModel = "claude-3-7-sonnet-latest"
+
+	Gemini20FlashModel = "gemini-2.0-flash"
+	Gemini15ProModel   = "gemini-1.5-pro"
 )
+
+// DefaultContextWindow is assumed for models missing from the table, e.g. self-hosted ones.
+const DefaultContextWindow = 8192
+
+// contextWindows holds the maximum number of tokens (prompt and completion) of each model.
+var contextWindows = map[string]int{
+	Gpt4oMiniModel:      128_000,
+	Gpt35TurboModel:     16_385,
+	Gpt4oModel:          128_000,
+	Gpt4TurboModel:      128_000,
+	O3MiniModel:         200_000,
+	Claude35HaikuModel:  200_000,
+	Claude37SonnetModel: 200_000,
+	Gemini20FlashModel:  1_048_576,
+	Gemini15ProModel:    2_097_152,
+}
+
+// ContextWindow returns the context size of the model in tokens.
+func ContextWindow(model string) int {
+	if size, ok := contextWindows[model]; ok {
+		return size
+	}
+	return DefaultContextWindow
+}
+
+// maxOutputs holds the maximum number of tokens each model may answer with.
+var maxOutputs = map[string]int{
+	Gpt4oMiniModel:      16_384,
+	Gpt35TurboModel:     4096,
+	Gpt4oModel:          16_384,
+	Gpt4TurboModel:      4096,
+	O3MiniModel:         100_000,
+	Claude35HaikuModel:  8192,
+	Claude37SonnetModel: 64_000,
+	Gemini20FlashModel:  8192,
+	Gemini15ProModel:    8192,
+}
+
+// OutputTokens returns the answer length to request from the model: the requested
+// number of tokens, or fallback if none is, capped at the longest answer the model
+// supports. Models missing from the table are not capped.
+func OutputTokens(model string, requested, fallback int) int {
+	tokens := fallback
+	if requested > 0 {
+		tokens = requested
+	}
+	if limit, ok := maxOutputs[model]; ok {
+		return min(tokens, limit)
+	}
+	return tokens
+}
+
+// Reasoning efforts of reasoning models. An empty effort leaves the provider default.
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+var ReasoningEfforts = []string{ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh}
+
+// IsReasoningModel reports whether the model thinks before answering, as the OpenAI
+// o-series models do. Such models take a reasoning effort instead of sampling parameters.
+func IsReasoningModel(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4"} {
+		if model == prefix || strings.HasPrefix(model, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// Usage is the amount of a model consumed by a single API call.
+type Usage struct {
+	Model           string
+	InputTokens     int
+	OutputTokens    int
+	ReasoningTokens int // Part of OutputTokens the model spent thinking
+	AudioSeconds    float64
+	Images          int
+	ImagePrice      float64 // Per image as drawn, zero for the list price of the model
+}
+
+// UsageRecord is a priced usage of a model made on behalf of a user in a chat.
+type UsageRecord struct {
+	ID           int64 `bun:",pk,autoincrement"`
+	UserID       int64
+	UserName     string
+	ChatID       int64
+	TopicID      int
+	Model        string
+	InputTokens  int
+	OutputTokens int
+	AudioSeconds float64
+	Images       int
+	Cost         float64 // USD
+	CreatedAt    time.Time
+}
+
+func NewUsageRecord(userID int64, userName string, chatID int64, topicID int, usage Usage) *UsageRecord {
+	return &UsageRecord{
+		UserID:       userID,
+		UserName:     userName,
+		ChatID:       chatID,
+		TopicID:      topicID,
+		Model:        usage.Model,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		AudioSeconds: usage.AudioSeconds,
+		Images:       usage.Images,
+		Cost:         PriceOf(usage.Model).Cost(usage),
+		CreatedAt:    time.Now(),
+	}
+}
+
+// UserSpend is the total cost of the usage of a single user.
+type UserSpend struct {
+	UserID   int64
+	UserName string
+	Cost     float64
+}
@@ -0,0 +1,280 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+)
+
+const (
+	DefaultBaseURL = "https://api.anthropic.com/v1"
+
+	apiVersion       = "2023-06-01"
+	defaultMaxTokens = 4096
+	maxTemperature   = 1.0
+	listModelsLimit  = 1000
+
+	streamDataPrefix  = "data: "
+	streamBufferSize  = 64 * 1024
+	streamMaxLineSize = 1024 * 1024
+)
+
+type client struct {
+	token   string
+	baseURL string
+	hc      *http.Client
+}
+
+func NewClient(token, baseURL string) (*client, error) {
+	if token == "" {
+		return nil, errors.New("token cannot be empty")
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &client{
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      llm.NewHTTPClient(),
+	}, nil
+}
+
+func (c *client) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	req, err := c.newMessagesRequest(ctx, chat, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send messages request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsedResp messagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse messages response: %w", err)
+	}
+
+	if parsedResp.Usage != nil {
+		llm.ReportUsage(ctx, domain.Usage{
+			Model:        chat.TextModel,
+			InputTokens:  parsedResp.Usage.InputTokens,
+			OutputTokens: parsedResp.Usage.OutputTokens,
+		})
+	}
+
+	var text strings.Builder
+	for _, block := range parsedResp.Content {
+		if block.Type == contentBlockTypeText {
+			text.WriteString(block.Text)
+		}
+	}
+
+	if text.Len() == 0 {
+		return nil, errors.New("no text content returned in response")
+	}
+
+	return &domain.Message{
+		Role:         parsedResp.Role,
+		ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: text.String()}},
+	}, nil
+}
+
+// CreateChatCompletionStream requests a streamed message and calls onDelta
+// for every text delta as it arrives.
+func (c *client) CreateChatCompletionStream(
+	ctx context.Context,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	req, err := c.newMessagesRequest(ctx, chat, true)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send messages request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	streamUsage := domain.Usage{Model: chat.TextModel}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, streamBufferSize), streamMaxLineSize)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), streamDataPrefix)
+		if !ok {
+			continue // Event names are repeated in the payload type
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse stream event: %w", err)
+		}
+
+		switch event.Type {
+		case streamEventMessageStart:
+			if event.Message != nil && event.Message.Usage != nil {
+				streamUsage.InputTokens = event.Message.Usage.InputTokens
+			}
+		case streamEventMessageDelta:
+			if event.Usage != nil {
+				streamUsage.OutputTokens = event.Usage.OutputTokens
+			}
+		case streamEventContentBlockDelta:
+			if event.Delta.Type == streamDeltaTypeText && event.Delta.Text != "" {
+				content.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case streamEventError:
+			if event.Error != nil {
+				return nil, fmt.Errorf("stream error: %s", event.Error.Message)
+			}
+			return nil, errors.New("stream error")
+		case streamEventMessageStop:
+			llm.ReportUsage(ctx, streamUsage)
+
+			return &domain.Message{
+				Role:         domain.MessageRoleAssistant,
+				ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: content.String()}},
+			}, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages stream: %w", err)
+	}
+
+	return nil, errors.New("stream ended before message was complete")
+}
+
+// ListModels returns the models available to the account.
+func (c *client) ListModels(ctx context.Context) ([]domain.ModelInfo, error) {
+	url := fmt.Sprintf("%s/models?limit=%d", c.baseURL, listModelsLimit)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsedResp listModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse models response: %w", err)
+	}
+
+	result := make([]domain.ModelInfo, 0, len(parsedResp.Data))
+	for _, model := range parsedResp.Data {
+		result = append(result, domain.ModelInfo{
+			ID:   model.ID,
+			Name: model.DisplayName,
+			Kind: domain.ModelKindText,
+			Capabilities: domain.Capabilities{
+				Vision: true, // All Claude 3 and later models understand images
+				Tools:  true,
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func (c *client) newMessagesRequest(ctx context.Context, chat *domain.Chat, stream bool) (*http.Request, error) {
+	messages, err := toMessages(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	body := messagesRequest{
+		Model:     chat.TextModel,
+		System:    chat.Instructions(),
+		Messages:  messages,
+		MaxTokens: domain.OutputTokens(chat.TextModel, chat.MaxTokens, defaultMaxTokens),
+		Stream:    stream,
+	}
+
+	// Claude takes temperatures up to 1 only, and rejects requests setting both the
+	// temperature and top P, so top P is only sent alone. Penalties are not supported
+	if chat.Temperature != nil {
+		temperature := min(*chat.Temperature, maxTemperature)
+		body.Temperature = &temperature
+	} else {
+		body.TopP = chat.TopP
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+func toMessages(chat *domain.Chat) ([]message, error) {
+	messages := make([]message, 0, len(chat.Messages))
+
+	for _, msg := range chat.Messages {
+		if msg.Role == domain.MessageRoleTool || len(msg.ContentParts) == 0 {
+			continue // Tool exchanges are only understood by the provider that made them
+		}
+
+		blocks := make([]contentBlock, 0, len(msg.ContentParts))
+		for _, part := range msg.ContentParts {
+			switch part.Type {
+			case domain.ContentPartTypeText:
+				blocks = append(blocks, contentBlock{Type: contentBlockTypeText, Text: part.Data})
+			case domain.ContentPartTypeImage:
+				mediaType, data, err := domain.ParseDataURL(part.Data)
+				if err != nil {
+					return nil, fmt.Errorf("invalid image content: %w", err)
+				}
+				blocks = append(blocks, contentBlock{
+					Type: contentBlockTypeImage,
+					Source: &imageSource{
+						Type:      imageSourceTypeBase64,
+						MediaType: mediaType,
+						Data:      data,
+					},
+				})
+			default:
+				return nil, errors.New("unsupported content type")
+			}
+		}
+		messages = append(messages, message{Role: msg.Role, Content: blocks})
+	}
+
+	return messages, nil
+}
+
+// send performs an authorized request, retrying transient failures, and returns the response
+// when its status is 2xx. The caller is responsible for closing the response body.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Api-Key", c.token)
+	req.Header.Set("Anthropic-Version", apiVersion)
+
+	return llm.Send(c.hc, req, llm.DefaultRetryPolicy)
+}
@@ -0,0 +1,82 @@
+package anthropic
+
+type messagesRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+type messagesResponse struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+	Usage   *usage         `json:"usage"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlockType string
+
+const (
+	contentBlockTypeText  contentBlockType = "text"
+	contentBlockTypeImage contentBlockType = "image"
+)
+
+type contentBlock struct {
+	Type   contentBlockType `json:"type"`
+	Text   string           `json:"text,omitempty"`
+	Source *imageSource     `json:"source,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+const imageSourceTypeBase64 = "base64"
+
+type streamEvent struct {
+	Type    string            `json:"type"`
+	Message *messagesResponse `json:"message,omitempty"` // Sent with message_start
+	Delta   streamDelta       `json:"delta"`
+	Usage   *usage            `json:"usage,omitempty"` // Sent with message_delta
+	Error   *apiError         `json:"error,omitempty"`
+}
+
+type streamDelta struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+const (
+	streamEventMessageStart      = "message_start"
+	streamEventContentBlockDelta = "content_block_delta"
+	streamEventMessageDelta      = "message_delta"
+	streamEventMessageStop       = "message_stop"
+	streamEventError             = "error"
+	streamDeltaTypeText          = "text_delta"
+)
+
+type listModelsResponse struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
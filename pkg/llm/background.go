@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+// ImageSubmitter starts drawing images without waiting for them, redrawing the image
+// if one is given. The predictions are polled, or posted to a webhook by the provider
+// once they complete. Every prediction is passed to submitted as soon as it is created,
+// and no more are created if submitted fails. The IDs of the created predictions are
+// returned even on failure.
+type ImageSubmitter interface {
+	SubmitImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings, submitted func(predictionID string) error) ([]string, error)
+}
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// SubmitterRoutes finds the providers drawing with an image model in the background.
+type SubmitterRoutes interface {
+	ImageSubmitter(model string) (ImageSubmitter, bool)
+}
+
+// ImageDrawer draws images while the caller waits, such as MultiProviderImageClient.
+type ImageDrawer interface {
+	GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([]domain.Image, error)
+	EditImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings) ([]domain.Image, error)
+}
+
+type ImageJobStore interface {
+	Save(ctx context.Context, job *domain.ImageJob) error
+	Position(ctx context.Context, job *domain.ImageJob) (int, error)
+	UpdateStatus(ctx context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error)
+	AddPrediction(ctx context.Context, prediction *domain.ImagePrediction) error
+}
+
+// BackgroundImageClient queues requests to draw images, so that they are drawn apart
+// from the handlers of the requests and survive restarts.
+type BackgroundImageClient struct {
+	providers SubmitterRoutes
+	images    ImageDrawer
+	jobs      ImageJobStore
+	queued    chan struct{}
+}
+
+func NewBackgroundImageClient(providers SubmitterRoutes, images ImageDrawer, jobs ImageJobStore) *BackgroundImageClient {
+	return &BackgroundImageClient{
+		providers: providers,
+		images:    images,
+		jobs:      jobs,
+		queued:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue saves the job to be drawn once its turn comes and returns its place in the queue.
+func (c *BackgroundImageClient) Enqueue(ctx context.Context, job *domain.ImageJob) (int, error) {
+	job.Status = domain.ImageJobStatusQueued
+	if err := c.jobs.Save(ctx, job); err != nil {
+		return 0, err
+	}
+
+	select {
+	case c.queued <- struct{}{}:
+	default:
+	}
+
+	return c.jobs.Position(ctx, job)
+}
+
+// Queued signals that jobs were enqueued, so that they don't wait for the queue to be polled.
+func (c *BackgroundImageClient) Queued() <-chan struct{} {
+	return c.queued
+}
+
+// DrawImage draws the images of the running job, redrawing the image if one is given.
+// Models whose providers draw in the background get predictions submitted instead, and
+// true is reported once the job is pending on them, also when only some of them were
+// submitted. The job is marked as submitting beforehand, and every prediction is saved
+// as soon as it is created, so that a restart never submits the job twice.
+func (c *BackgroundImageClient) DrawImage(ctx context.Context, job *domain.ImageJob, image []byte, prompt string) ([]domain.Image, bool, error) {
+	submitter, ok := c.providers.ImageSubmitter(job.Model)
+	if !ok {
+		if image == nil {
+			images, err := c.images.GenerateImage(ctx, prompt, job.Model, job.Settings)
+			return images, false, err
+		}
+		images, err := c.images.EditImage(ctx, image, prompt, job.Model, job.Settings)
+		return images, false, err
+	}
+
+	if err := c.moveJob(ctx, job, domain.ImageJobStatusSubmitting); err != nil {
+		return nil, false, err
+	}
+
+	_, err := submitter.SubmitImage(ctx, image, prompt, job.Model, job.Settings, func(predictionID string) error {
+		prediction := domain.ImagePrediction{ID: predictionID, JobID: job.ID}
+		if err := c.jobs.AddPrediction(ctx, &prediction); err != nil {
+			return fmt.Errorf("saving prediction %s: %w", predictionID, err)
+		}
+		job.Predictions = append(job.Predictions, prediction)
+		return nil
+	})
+	if len(job.Predictions) == 0 {
+		return nil, false, err
+	}
+
+	if moveErr := c.moveJob(ctx, job, domain.ImageJobStatusPending); moveErr != nil {
+		return nil, false, moveErr
+	}
+
+	return nil, true, err
+}
+
+// moveJob moves the job from its status to the given one. The job keeps its status if
+// it can't be moved.
+func (c *BackgroundImageClient) moveJob(ctx context.Context, job *domain.ImageJob, status domain.ImageJobStatus) error {
+	from := job.Status
+
+	job.Status = status
+	moved, err := c.jobs.UpdateStatus(ctx, job, from)
+	if err == nil && !moved {
+		err = fmt.Errorf("image job %d is not %s anymore", job.ID, from)
+	}
+	if err != nil {
+		job.Status = from
+		return err
+	}
+
+	return nil
+}
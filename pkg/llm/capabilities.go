@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+// ModelRegistry tells what the offered models can do, e.g. the ModelCatalog.
+type ModelRegistry interface {
+	Model(id string) (domain.ModelInfo, bool)
+	TextModels() []domain.ModelInfo
+}
+
+// CapabilityGuard makes sure that the model answering a chat can handle it,
+// before the request reaches the provider.
+type CapabilityGuard struct {
+	models    ModelRegistry
+	fallbacks FallbackChains
+	policy    domain.CapabilityPolicy
+}
+
+func NewCapabilityGuard(models ModelRegistry, fallbacks FallbackChains, policy domain.CapabilityPolicy) *CapabilityGuard {
+	return &CapabilityGuard{
+		models:    models,
+		fallbacks: fallbacks,
+		policy:    policy,
+	}
+}
+
+// Resolve returns the model to answer the chat with. That is the chat model if it
+// can handle the chat, otherwise a capable model if the policy allows rerouting:
+// the fallbacks of the chat model are preferred, then the offered models in order.
+// When rerouted, the capabilities the chat model lacks are returned along with the
+// model. A *domain.IncapableModelError is returned if there is no capable model.
+func (g *CapabilityGuard) Resolve(ctx context.Context, chat *domain.Chat, stream bool) (string, []domain.Capability, error) {
+	req := RequirementsOf(chat, stream)
+
+	missing := g.capabilities(chat.TextModel).Missing(req)
+	if len(missing) == 0 {
+		return chat.TextModel, nil, nil
+	}
+
+	incapable := &domain.IncapableModelError{Model: chat.TextModel, Missing: missing}
+
+	if g.policy != domain.CapabilityPolicyReroute {
+		return "", nil, incapable
+	}
+
+	candidates := g.fallbacks.candidates(chat.TextModel)[1:]
+	for _, info := range g.models.TextModels() {
+		candidates = append(candidates, info.ID)
+	}
+
+	for _, model := range candidates {
+		info, ok := g.models.Model(model)
+		if ok && info.Kind == domain.ModelKindText && len(info.Missing(req)) == 0 {
+			slog.InfoContext(ctx, "Rerouting request to a capable model", "model", chat.TextModel, "missing", missing, "reroutedTo", model)
+			return model, missing, nil
+		}
+	}
+
+	return "", nil, incapable
+}
+
+// capabilities of the model as offered, or as far as known if it is not offered.
+func (g *CapabilityGuard) capabilities(model string) domain.Capabilities {
+	if info, ok := g.models.Model(model); ok && info.Kind == domain.ModelKindText {
+		return info.Capabilities
+	}
+	return domain.CapabilitiesOf(model)
+}
+
+// RequirementsOf returns what the chat needs from the model answering it, with the answer
+// streamed if asked to. Tool exchanges in the history are sent back to the model, which
+// has to understand them. The context has to fit at least the instructions, the latest
+// turn and the answer, as earlier messages can be trimmed.
+func RequirementsOf(chat *domain.Chat, stream bool) domain.Requirements {
+	var req domain.Requirements
+
+	if stream {
+		req.Capabilities = append(req.Capabilities, domain.CapabilityStreaming)
+	}
+
+	hasImages := func(msg domain.Message) bool {
+		return slices.ContainsFunc(msg.ContentParts, func(part domain.ContentPart) bool {
+			return part.Type == domain.ContentPartTypeImage
+		})
+	}
+	if slices.ContainsFunc(chat.Messages, hasImages) {
+		req.Capabilities = append(req.Capabilities, domain.CapabilityVision)
+	}
+
+	hasToolExchange := func(msg domain.Message) bool {
+		return msg.Role == domain.MessageRoleTool || len(msg.ToolCalls) > 0
+	}
+	if slices.ContainsFunc(chat.Messages, hasToolExchange) {
+		req.Capabilities = append(req.Capabilities, domain.CapabilityTools)
+	}
+
+	counter := TokenCounterFor(chat.TextModel)
+	req.Context = outputReserve(chat) +
+		counter.CountText(chat.Instructions()) +
+		countMessages(counter, chat.Messages[latestTurnStart(chat.Messages):])
+
+	return req
+}
@@ -0,0 +1,254 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// ModelLister is implemented by providers that can list the models they serve.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]domain.ModelInfo, error)
+}
+
+// CatalogSource is a provider contributing models to the catalog.
+type CatalogSource struct {
+	Provider    string
+	Text        TextGenerator  // Serves the text models of the provider, if any
+	Image       ImageGenerator // Serves the image models of the provider, if any
+	Editor      ImageEditor    // Edits images with the image models of the provider that can, if any
+	Submitter   ImageSubmitter // Draws with the image models of the provider in the background, if it can
+	Lister      ModelLister    // Discovers more models, nil if the provider can't list them
+	TextModels  []string       // Known to be served, offered before the first discovery and if it fails
+	ImageModels []string
+
+	// Capabilities granted to all text models of the provider on top of what is known about them
+	Capabilities domain.Capabilities
+}
+
+// ModelFilter decides which models are offered by glob patterns on their IDs,
+// e.g. "gpt-4o*". Denied models are left out even if allowed. An empty allow
+// list allows all models.
+type ModelFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+func (f ModelFilter) allows(id string) bool {
+	matches := func(pattern string) bool {
+		ok, _ := path.Match(strings.TrimSpace(pattern), id)
+		return ok
+	}
+
+	if len(f.Allow) > 0 && !slices.ContainsFunc(f.Allow, matches) {
+		return false
+	}
+
+	return !slices.ContainsFunc(f.Deny, matches)
+}
+
+type catalogEntry struct {
+	info   domain.ModelInfo
+	source *CatalogSource
+}
+
+// ModelCatalog keeps the models offered to users along with their metadata,
+// and routes requests to the providers serving them.
+type ModelCatalog struct {
+	sources []CatalogSource
+	filter  ModelFilter
+
+	mu         sync.RWMutex
+	entries    map[string]catalogEntry
+	order      []string
+	discovered map[string][]domain.ModelInfo // Last successful listing per provider
+}
+
+// NewModelCatalog creates a catalog offering the known models of the sources until Refresh discovers more.
+func NewModelCatalog(sources []CatalogSource, filter ModelFilter) *ModelCatalog {
+	c := &ModelCatalog{
+		sources:    sources,
+		filter:     filter,
+		discovered: map[string][]domain.ModelInfo{},
+	}
+	c.rebuild()
+	return c
+}
+
+// Refresh lists the models of every provider that can list them. A provider that
+// fails keeps the models it listed last time.
+func (c *ModelCatalog) Refresh(ctx context.Context) {
+	for i := range c.sources {
+		source := &c.sources[i]
+		if source.Lister == nil {
+			continue
+		}
+
+		models, err := source.Lister.ListModels(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to list models", "provider", source.Provider, logger.Err(err))
+			continue
+		}
+
+		c.mu.Lock()
+		c.discovered[source.Provider] = models
+		c.mu.Unlock()
+	}
+
+	c.rebuild()
+
+	slog.InfoContext(ctx, "Model catalog refreshed", "textModels", len(c.TextModels()), "imageModels", len(c.ImageModels()))
+}
+
+// rebuild merges the known and the discovered models of the sources. Known models
+// go first, in the order given, then the discovered ones sorted by ID. Discovered
+// models are only offered once their price is known, see domain.SetPrices. The
+// first source to offer a model serves it.
+func (c *ModelCatalog) rebuild() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := map[string]catalogEntry{}
+	var order []string
+
+	add := func(source *CatalogSource, info domain.ModelInfo) {
+		if _, ok := entries[info.ID]; ok || !c.filter.allows(info.ID) {
+			return
+		}
+		if (info.Kind == domain.ModelKindText && source.Text == nil) || (info.Kind == domain.ModelKindImage && source.Image == nil) {
+			return
+		}
+
+		info.Provider = source.Provider
+		if info.Kind == domain.ModelKindText {
+			info.Capabilities = info.Capabilities.Merge(source.Capabilities)
+		}
+		entries[info.ID] = catalogEntry{info: info.Enrich(), source: source}
+		order = append(order, info.ID)
+	}
+
+	for i := range c.sources {
+		source := &c.sources[i]
+
+		discovered := map[string]domain.ModelInfo{}
+		for _, info := range c.discovered[source.Provider] {
+			discovered[info.ID] = info
+		}
+
+		known := func(ids []string, kind domain.ModelKind) {
+			for _, id := range ids {
+				info, ok := discovered[id]
+				if !ok {
+					info = domain.ModelInfo{ID: id}
+				}
+				info.Kind = kind
+				add(source, info)
+			}
+		}
+		known(source.TextModels, domain.ModelKindText)
+		known(source.ImageModels, domain.ModelKindImage)
+
+		rest := slices.SortedFunc(maps.Values(discovered), func(a, b domain.ModelInfo) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+
+		for _, info := range rest {
+			// Usage of a model without a known price would never count against quotas
+			if info.Enrich().Price == (domain.Price{}) {
+				slog.Debug("Skipping model without a known price", "provider", source.Provider, "model", info.ID)
+				continue
+			}
+			add(source, info)
+		}
+	}
+
+	c.entries = entries
+	c.order = order
+}
+
+// Model returns the metadata of an offered model.
+func (c *ModelCatalog) Model(id string) (domain.ModelInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[id]
+	return entry.info, ok
+}
+
+// TextModels returns the offered text models.
+func (c *ModelCatalog) TextModels() []domain.ModelInfo {
+	return c.models(domain.ModelKindText)
+}
+
+// ImageModels returns the offered image models.
+func (c *ModelCatalog) ImageModels() []domain.ModelInfo {
+	return c.models(domain.ModelKindImage)
+}
+
+func (c *ModelCatalog) models(kind domain.ModelKind) []domain.ModelInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []domain.ModelInfo
+	for _, id := range c.order {
+		if info := c.entries[id].info; info.Kind == kind {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+// TextGenerator returns the provider serving the text model.
+func (c *ModelCatalog) TextGenerator(model string) (TextGenerator, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[model]
+	if !ok || entry.info.Kind != domain.ModelKindText {
+		return nil, false
+	}
+	return entry.source.Text, true
+}
+
+// ImageGenerator returns the provider serving the image model.
+func (c *ModelCatalog) ImageGenerator(model string) (ImageGenerator, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[model]
+	if !ok || entry.info.Kind != domain.ModelKindImage {
+		return nil, false
+	}
+	return entry.source.Image, true
+}
+
+// ImageEditor returns the provider editing images with the image model, if the model can.
+func (c *ModelCatalog) ImageEditor(model string) (ImageEditor, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[model]
+	if !ok || entry.info.Kind != domain.ModelKindImage || !entry.info.Editing || entry.source.Editor == nil {
+		return nil, false
+	}
+	return entry.source.Editor, true
+}
+
+// ImageSubmitter returns the provider drawing with the image model in the background, if it can.
+func (c *ModelCatalog) ImageSubmitter(model string) (ImageSubmitter, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[model]
+	if !ok || entry.info.Kind != domain.ModelKindImage || entry.source.Submitter == nil {
+		return nil, false
+	}
+	return entry.source.Submitter, true
+}
@@ -0,0 +1,484 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	_ "image/jpeg" // Edited photos come from Telegram as JPEG
+	"image/png"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/llm/replicate"
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+const (
+	imageSize = 256
+
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+)
+
+// webhookPrediction is a prediction posted by SubmitImage, shaped like the ones of Replicate.
+type webhookPrediction struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// toPrediction returns the prediction with its output as JSON, like the one of Replicate.
+func (p webhookPrediction) toPrediction() *domain.Prediction {
+	prediction := &domain.Prediction{ID: p.ID, Done: true}
+	if p.Status != "succeeded" {
+		prediction.Err = fmt.Errorf("prediction failed: %s", p.Error)
+		return prediction
+	}
+	prediction.Output, _ = json.Marshal(p.Output)
+	return prediction
+}
+
+var imageSizes = map[string]int{
+	domain.ImageSizeSmall:  256,
+	domain.ImageSizeMedium: 512,
+	domain.ImageSizeLarge:  1024,
+}
+
+// client stands in for the model providers offline. Its answers depend only on
+// the input, so that the bot can be run and tested without API tokens.
+type client struct {
+	webhookURL    string
+	webhookSecret string
+	hc            *http.Client
+
+	mu          sync.Mutex
+	predictions map[string]*domain.Prediction // Submitted in this run, by ID
+}
+
+type Option func(*client)
+
+// WithWebhook makes the client post submitted predictions to the URL the way Replicate
+// does, signed with the secret. The URL is usually the bot's own webhook.
+func WithWebhook(url, secret string) Option {
+	return func(c *client) {
+		c.webhookURL = url
+		c.webhookSecret = secret
+	}
+}
+
+// NewClient creates a provider that generates text, images and transcriptions without any
+// network access, except for posting webhooks.
+func NewClient(opts ...Option) *client {
+	c := &client{
+		hc:          &http.Client{Timeout: webhookTimeout},
+		predictions: map[string]*domain.Prediction{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreateChatCompletion repeats the latest user message back.
+func (c *client) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	answer := answerTo(chat)
+
+	counter := llm.TokenCounterFor(chat.TextModel)
+	inputTokens := counter.CountText(chat.Instructions())
+	for _, msg := range chat.Messages {
+		inputTokens += counter.CountMessage(msg)
+	}
+
+	llm.ReportUsage(ctx, domain.Usage{
+		Model:        chat.TextModel,
+		InputTokens:  inputTokens,
+		OutputTokens: counter.CountText(answer),
+	})
+
+	return &domain.Message{
+		Role:         domain.MessageRoleAssistant,
+		ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: answer}},
+	}, nil
+}
+
+// CreateChatCompletionStream delivers the answer of CreateChatCompletion word by word.
+func (c *client) CreateChatCompletionStream(
+	ctx context.Context,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	msg, err := c.CreateChatCompletion(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, word := range strings.SplitAfter(msg.ContentParts[0].Data, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		onDelta(word)
+	}
+
+	return msg, nil
+}
+
+// GenerateImage draws gradients whose colors are derived from the prompt and the model,
+// in the size and aspect ratio of the settings. Every next image gets other colors.
+func (c *client) GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
+	width, height := imageDimensions(settings)
+
+	var images [][]byte
+	for i := range settings.ImageCount() {
+		from := promptColor(variant(prompt, i), model)
+		to := color.RGBA{R: 255 - from.R, G: 255 - from.G, B: 255 - from.B, A: 255}
+
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := range height {
+			for x := range width {
+				t := (x + y) * 255 / (width + height - 2)
+				img.SetRGBA(x, y, color.RGBA{
+					R: blend(from.R, to.R, t),
+					G: blend(from.G, to.G, t),
+					B: blend(from.B, to.B, t),
+					A: 255,
+				})
+			}
+		}
+
+		data, err := encode(ctx, img, model)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, data)
+	}
+
+	return images, nil
+}
+
+// EditImage tints the image halfway to colors derived from the prompt and the model,
+// another color for every image the settings ask for.
+func (c *client) EditImage(ctx context.Context, data []byte, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	const half = 128
+	bounds := src.Bounds()
+
+	var images [][]byte
+	for i := range settings.ImageCount() {
+		tint := promptColor(variant(prompt, i), model)
+
+		img := image.NewRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixel := color.RGBAModel.Convert(src.At(x, y)).(color.RGBA)
+				img.SetRGBA(x, y, color.RGBA{
+					R: blend(pixel.R, tint.R, half),
+					G: blend(pixel.G, tint.G, half),
+					B: blend(pixel.B, tint.B, half),
+					A: 255,
+				})
+			}
+		}
+
+		edited, err := encode(ctx, img, model)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, edited)
+	}
+
+	return images, nil
+}
+
+// UpscaleImage enlarges the image twice by repeating its pixels.
+func (c *client) UpscaleImage(ctx context.Context, data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	const scale = 2
+	bounds := src.Bounds()
+
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*scale, bounds.Dy()*scale))
+	for y := range img.Bounds().Dy() {
+		for x := range img.Bounds().Dx() {
+			img.Set(x, y, src.At(bounds.Min.X+x/scale, bounds.Min.Y+y/scale))
+		}
+	}
+
+	return encode(ctx, img, domain.RealESRGANModel)
+}
+
+// SubmitImage draws the images in the background, each of them as a prediction of its
+// own with the image as a data URL, and posts the predictions to the webhook if any.
+func (c *client) SubmitImage(
+	ctx context.Context,
+	image []byte,
+	prompt string,
+	model string,
+	settings domain.ImageSettings,
+	submitted func(predictionID string) error,
+) ([]string, error) {
+	var predictionIDs []string
+	var err error
+	for i := range settings.ImageCount() {
+		predictionID := fmt.Sprintf("fake-%d-%d", time.Now().UnixNano(), i)
+
+		c.mu.Lock()
+		c.predictions[predictionID] = &domain.Prediction{ID: predictionID}
+		c.mu.Unlock()
+
+		predictionIDs = append(predictionIDs, predictionID)
+		if err = submitted(predictionID); err != nil {
+			break
+		}
+	}
+
+	go func() {
+		// Usage is reported once the predictions are read, as with Replicate
+		ctx := context.Background()
+
+		var images [][]byte
+		var err error
+		if image != nil {
+			images, err = c.EditImage(ctx, image, prompt, model, settings)
+		} else {
+			images, err = c.GenerateImage(ctx, prompt, model, settings)
+		}
+
+		for i, predictionID := range predictionIDs {
+			prediction := webhookPrediction{ID: predictionID, Status: "succeeded"}
+			if err != nil {
+				prediction.Status, prediction.Error = "failed", err.Error()
+			} else {
+				prediction.Output = "data:image/png;base64," + base64.StdEncoding.EncodeToString(images[i])
+			}
+
+			c.mu.Lock()
+			c.predictions[predictionID] = prediction.toPrediction()
+			c.mu.Unlock()
+
+			if c.webhookURL == "" {
+				continue
+			}
+			if err := c.postWebhook(ctx, prediction); err != nil {
+				slog.WarnContext(ctx, "Failed to post webhook", "predictionID", predictionID, logger.Err(err))
+			}
+		}
+	}()
+
+	return predictionIDs, err
+}
+
+// ParsePrediction verifies and reads a prediction posted by SubmitImage.
+func (c *client) ParsePrediction(header http.Header, body []byte) (*domain.Prediction, error) {
+	if err := replicate.VerifyWebhook(c.webhookSecret, header, body, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var prediction webhookPrediction
+	if err := json.Unmarshal(body, &prediction); err != nil {
+		return nil, fmt.Errorf("failed to parse prediction: %w", err)
+	}
+
+	return prediction.toPrediction(), nil
+}
+
+// GetPrediction returns a prediction submitted since the client was created.
+func (c *client) GetPrediction(_ context.Context, predictionID string) (*domain.Prediction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prediction, ok := c.predictions[predictionID]
+	if !ok {
+		return nil, fmt.Errorf("unknown prediction: %s", predictionID)
+	}
+
+	return prediction, nil
+}
+
+// PredictionImages decodes the image of a prediction posted by SubmitImage.
+func (c *client) PredictionImages(ctx context.Context, model string, prediction *domain.Prediction) ([][]byte, error) {
+	if prediction.Err != nil {
+		return nil, prediction.Err
+	}
+
+	var output string
+	if err := json.Unmarshal(prediction.Output, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse output: %w", err)
+	}
+
+	_, data, _ := strings.Cut(output, ";base64,")
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	llm.ReportUsage(ctx, domain.Usage{Model: model, Images: 1})
+
+	return [][]byte{image}, nil
+}
+
+// postWebhook posts the prediction, retrying a few times like Replicate does, as the bot
+// may not have saved the job of the prediction yet.
+func (c *client) postWebhook(ctx context.Context, prediction webhookPrediction) error {
+	body, err := json.Marshal(prediction)
+	if err != nil {
+		return fmt.Errorf("failed to marshal prediction: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signature, err := replicate.SignWebhook(c.webhookSecret, prediction.ID, timestamp, body)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = c.tryPostWebhook(ctx, body, prediction.ID, timestamp, signature)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (c *client) tryPostWebhook(ctx context.Context, body []byte, id, timestamp, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("webhook-id", id)
+	req.Header.Set("webhook-timestamp", timestamp)
+	req.Header.Set("webhook-signature", signature)
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GenerateImagePrompt returns the prompt as is.
+func (c *client) GenerateImagePrompt(_ context.Context, prompt string) (string, error) {
+	return prompt, nil
+}
+
+// ClassifyIntent looks for keywords, as the real classifier falls back to.
+func (c *client) ClassifyIntent(ctx context.Context, req domain.IntentRequest) (domain.Intent, error) {
+	return llm.KeywordClassifier{}.ClassifyIntent(ctx, req)
+}
+
+// TranscribeAudio describes the audio file instead of recognizing speech in it.
+func (c *client) TranscribeAudio(_ context.Context, audioFilePath string) (string, error) {
+	data, err := os.ReadFile(audioFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	h := fnv.New32a()
+	h.Write(data)
+
+	return fmt.Sprintf("Fake transcription of %d bytes of audio #%08x", len(data), h.Sum32()), nil
+}
+
+func answerTo(chat *domain.Chat) string {
+	var text []string
+	images := 0
+
+	for i := len(chat.Messages) - 1; i >= 0; i-- {
+		msg := chat.Messages[i]
+		if msg.Role != domain.MessageRoleUser {
+			continue
+		}
+
+		for _, part := range msg.ContentParts {
+			if part.Type == domain.ContentPartTypeImage {
+				images++
+				continue
+			}
+			text = append(text, part.Data)
+		}
+		break
+	}
+
+	answer := fmt.Sprintf("Fake %s answer to: %s", chat.TextModel, strings.Join(text, " "))
+	if images > 0 {
+		answer += fmt.Sprintf(" (with %d image(s))", images)
+	}
+
+	return answer
+}
+
+// imageDimensions fits the aspect ratio of the settings into a square of their size.
+func imageDimensions(settings domain.ImageSettings) (int, int) {
+	side := imageSizes[settings.Size]
+	if side == 0 {
+		side = imageSize
+	}
+
+	w, h, ok := settings.Ratio()
+	switch {
+	case !ok:
+		return side, side
+	case w > h:
+		return side, side * h / w
+	default:
+		return side * w / h, side
+	}
+}
+
+// variant tells apart the prompts of the images drawn at once, keeping the first one as is.
+func variant(prompt string, i int) string {
+	if i == 0 {
+		return prompt
+	}
+	return fmt.Sprintf("%s\n#%d", prompt, i+1)
+}
+
+func promptColor(prompt, model string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(model + "\n" + prompt))
+	sum := h.Sum32()
+
+	return color.RGBA{R: byte(sum), G: byte(sum >> 8), B: byte(sum >> 16), A: 255}
+}
+
+func encode(ctx context.Context, img image.Image, model string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	llm.ReportUsage(ctx, domain.Usage{Model: model, Images: 1})
+
+	return buf.Bytes(), nil
+}
+
+func blend(from, to byte, t int) byte {
+	return byte((int(from)*(255-t) + int(to)*t) / 255)
+}
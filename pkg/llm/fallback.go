@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// FallbackChains lists per model the models to try, in order, when it fails.
+type FallbackChains map[string][]string
+
+// candidates returns the model followed by its fallbacks.
+func (f FallbackChains) candidates(model string) []string {
+	return append([]string{model}, f[model]...)
+}
+
+// shouldFallBack reports whether another model may succeed where the failed one did not.
+// Requests cancelled by the caller or rejected for their content are not retried elsewhere.
+func shouldFallBack(ctx context.Context, model string, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrContentPolicy) {
+		return false
+	}
+
+	slog.WarnContext(ctx, "Model failed, falling back", "model", model, logger.Err(err))
+
+	return true
+}
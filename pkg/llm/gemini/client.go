@@ -0,0 +1,298 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+)
+
+const (
+	DefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+	defaultMaxTokens      = 4096
+	listModelsPageSize    = 1000
+	methodGenerateContent = "generateContent"
+
+	streamDataPrefix  = "data: "
+	streamBufferSize  = 64 * 1024
+	streamMaxLineSize = 1024 * 1024
+)
+
+type client struct {
+	token   string
+	baseURL string
+	hc      *http.Client
+}
+
+func NewClient(token, baseURL string) (*client, error) {
+	if token == "" {
+		return nil, errors.New("token cannot be empty")
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &client{
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      llm.NewHTTPClient(),
+	}, nil
+}
+
+func (c *client) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	url := fmt.Sprintf("%s/models/%s:generateContent", c.baseURL, chat.TextModel)
+
+	req, err := c.newGenerateContentRequest(ctx, url, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send generate content request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsedResp generateContentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse generate content response: %w", err)
+	}
+
+	reportUsage(ctx, chat.TextModel, parsedResp.UsageMetadata)
+
+	text, err := responseText(&parsedResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Message{
+		Role:         domain.MessageRoleAssistant,
+		ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: text}},
+	}, nil
+}
+
+// CreateChatCompletionStream requests a streamed response over server-sent events
+// and calls onDelta for every piece of text as it arrives.
+func (c *client) CreateChatCompletionStream(
+	ctx context.Context,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", c.baseURL, chat.TextModel)
+
+	req, err := c.newGenerateContentRequest(ctx, url, chat)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send generate content request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var lastUsage *usageMetadata
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, streamBufferSize), streamMaxLineSize)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), streamDataPrefix)
+		if !ok {
+			continue
+		}
+
+		var chunk generateContentResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse generate content chunk: %w", err)
+		}
+
+		if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			return nil, fmt.Errorf("prompt blocked: %s: %w", chunk.PromptFeedback.BlockReason, llm.ErrContentPolicy)
+		}
+
+		if chunk.UsageMetadata != nil {
+			lastUsage = chunk.UsageMetadata // Totals so far, the last chunk has the final ones
+		}
+
+		for _, cand := range chunk.Candidates {
+			for _, p := range cand.Content.Parts {
+				if p.Text != "" {
+					text.WriteString(p.Text)
+					onDelta(p.Text)
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read generate content stream: %w", err)
+	}
+
+	reportUsage(ctx, chat.TextModel, lastUsage)
+
+	return &domain.Message{
+		Role:         domain.MessageRoleAssistant,
+		ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: text.String()}},
+	}, nil
+}
+
+// ListModels returns the models that can generate content.
+func (c *client) ListModels(ctx context.Context) ([]domain.ModelInfo, error) {
+	url := fmt.Sprintf("%s/models?pageSize=%d", c.baseURL, listModelsPageSize)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsedResp listModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse models response: %w", err)
+	}
+
+	var result []domain.ModelInfo
+	for _, model := range parsedResp.Models {
+		if !slices.Contains(model.SupportedGenerationMethods, methodGenerateContent) {
+			continue
+		}
+
+		result = append(result, domain.ModelInfo{
+			ID:        strings.TrimPrefix(model.Name, "models/"),
+			Name:      model.DisplayName,
+			Kind:      domain.ModelKindText,
+			Reasoning: model.Thinking,
+			Capabilities: domain.Capabilities{
+				MaxContext: model.InputTokenLimit + model.OutputTokenLimit,
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func (c *client) newGenerateContentRequest(ctx context.Context, url string, chat *domain.Chat) (*http.Request, error) {
+	contents, err := toContents(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Penalties are left out, not every Gemini model supports them
+	body := generateContentRequest{
+		Contents: contents,
+		GenerationConfig: &generationConfig{
+			MaxOutputTokens: domain.OutputTokens(chat.TextModel, chat.MaxTokens, defaultMaxTokens),
+			Temperature:     chat.Temperature,
+			TopP:            chat.TopP,
+		},
+	}
+
+	if instructions := chat.Instructions(); instructions != "" {
+		body.SystemInstruction = &content{Parts: []part{{Text: instructions}}}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+func toContents(chat *domain.Chat) ([]content, error) {
+	contents := make([]content, 0, len(chat.Messages))
+
+	for _, msg := range chat.Messages {
+		if msg.Role == domain.MessageRoleTool || len(msg.ContentParts) == 0 {
+			continue // Tool exchanges are only understood by the provider that made them
+		}
+
+		role := roleModel
+		if msg.Role == domain.MessageRoleUser {
+			role = roleUser
+		}
+
+		parts := make([]part, 0, len(msg.ContentParts))
+		for _, contentPart := range msg.ContentParts {
+			switch contentPart.Type {
+			case domain.ContentPartTypeText:
+				parts = append(parts, part{Text: contentPart.Data})
+			case domain.ContentPartTypeImage:
+				mimeType, data, err := domain.ParseDataURL(contentPart.Data)
+				if err != nil {
+					return nil, fmt.Errorf("invalid image content: %w", err)
+				}
+				parts = append(parts, part{InlineData: &inlineData{MimeType: mimeType, Data: data}})
+			default:
+				return nil, errors.New("unsupported content type")
+			}
+		}
+		contents = append(contents, content{Role: role, Parts: parts})
+	}
+
+	return contents, nil
+}
+
+func reportUsage(ctx context.Context, model string, usage *usageMetadata) {
+	if usage == nil {
+		return
+	}
+
+	llm.ReportUsage(ctx, domain.Usage{
+		Model:           model,
+		InputTokens:     usage.PromptTokenCount,
+		OutputTokens:    usage.CandidatesTokenCount + usage.ThoughtsTokenCount, // Thinking is billed as output
+		ReasoningTokens: usage.ThoughtsTokenCount,
+	})
+}
+
+func responseText(resp *generateContentResponse) (string, error) {
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return "", fmt.Errorf("prompt blocked: %s: %w", resp.PromptFeedback.BlockReason, llm.ErrContentPolicy)
+	}
+
+	if len(resp.Candidates) == 0 {
+		return "", errors.New("no candidates returned in response")
+	}
+
+	var text strings.Builder
+	for _, p := range resp.Candidates[0].Content.Parts {
+		text.WriteString(p.Text)
+	}
+
+	if text.Len() == 0 {
+		return "", fmt.Errorf("empty response, finish reason: %s", resp.Candidates[0].FinishReason)
+	}
+
+	return text.String(), nil
+}
+
+// send performs an authorized request, retrying transient failures, and returns the response
+// when its status is 2xx. The caller is responsible for closing the response body.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Goog-Api-Key", c.token)
+
+	return llm.Send(c.hc, req, llm.DefaultRetryPolicy)
+}
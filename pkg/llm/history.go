@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+const (
+	reservedOutputTokens   = 4096 // Max tokens the clients request for an answer by default
+	minShrunkMessageTokens = 256  // Shorter remainders of a message are not worth keeping
+	omittedImageText       = "[image omitted]"
+	shrunkMessagePrefix    = "…"
+)
+
+// HistoryManager keeps chat history within the model limits and resets it once the chat TTL expires.
+type HistoryManager interface {
+	Expire(ctx context.Context, chat *domain.Chat)
+	Fit(ctx context.Context, chat *domain.Chat) bool
+}
+
+// HistoryTrimmer fits chat history into the context window of the chat model.
+type HistoryTrimmer struct{}
+
+func NewHistoryTrimmer() *HistoryTrimmer {
+	return &HistoryTrimmer{}
+}
+
+// Expire starts the conversation over once the chat TTL has passed.
+func (t *HistoryTrimmer) Expire(_ context.Context, chat *domain.Chat) {
+	chat.Messages = nil
+	chat.Summary = ""
+}
+
+// Fit keeps the system prompt and the latest turn, then as many earlier messages
+// as fit, newest first. Images of earlier messages are dropped before whole
+// messages, and the oldest kept message may be cut short. It reports whether
+// anything was removed from the history.
+func (t *HistoryTrimmer) Fit(_ context.Context, chat *domain.Chat) bool {
+	counter := TokenCounterFor(chat.TextModel)
+	budget := domain.ContextWindow(chat.TextModel) - outputReserve(chat) - counter.CountText(chat.Instructions())
+
+	msgs := chat.Messages
+	total := countMessages(counter, msgs)
+	if total <= budget {
+		return false
+	}
+
+	latest := latestTurnStart(msgs)
+
+	// Images are the most expensive part of old messages, drop them first
+	for i := 0; i < latest && total > budget; i++ {
+		stripped := withoutImages(msgs[i])
+		total += counter.CountMessage(stripped) - counter.CountMessage(msgs[i])
+		msgs[i] = stripped
+	}
+
+	if total <= budget {
+		return true
+	}
+
+	used := countMessages(counter, msgs[latest:])
+	start := latest
+	for start > 0 {
+		cost := counter.CountMessage(msgs[start-1])
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	kept := msgs[start:]
+
+	if remaining := budget - used; start > 0 && remaining >= minShrunkMessageTokens {
+		if shrunk, ok := shrinkMessage(msgs[start-1], remaining, counter); ok {
+			kept = append([]domain.Message{shrunk}, kept...)
+		}
+	}
+
+	// History must not begin with an answer or a dangling tool exchange
+	for len(kept) > 0 && kept[0].Role != domain.MessageRoleUser {
+		kept = kept[1:]
+	}
+
+	chat.Messages = kept
+
+	return true
+}
+
+// outputReserve returns the number of tokens kept free for the answer.
+func outputReserve(chat *domain.Chat) int {
+	return domain.OutputTokens(chat.TextModel, chat.MaxTokens, reservedOutputTokens)
+}
+
+func countMessages(counter TokenCounter, msgs []domain.Message) int {
+	total := 0
+	for _, msg := range msgs {
+		total += counter.CountMessage(msg)
+	}
+	return total
+}
+
+// latestTurnStart returns the index of the last user message.
+func latestTurnStart(msgs []domain.Message) int {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == domain.MessageRoleUser {
+			return i
+		}
+	}
+	return 0
+}
+
+func withoutImages(msg domain.Message) domain.Message {
+	parts := make([]domain.ContentPart, 0, len(msg.ContentParts))
+	for _, part := range msg.ContentParts {
+		if part.Type != domain.ContentPartTypeImage {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == len(msg.ContentParts) {
+		return msg
+	}
+
+	if len(parts) == 0 {
+		parts = append(parts, domain.ContentPart{Type: domain.ContentPartTypeText, Data: omittedImageText})
+	}
+
+	msg.ContentParts = parts
+	return msg
+}
+
+// shrinkMessage keeps the end of a plain text message so that it fits into the given number of tokens.
+func shrinkMessage(msg domain.Message, tokens int, counter TokenCounter) (domain.Message, bool) {
+	if msg.Role == domain.MessageRoleTool || len(msg.ToolCalls) > 0 ||
+		len(msg.ContentParts) != 1 || msg.ContentParts[0].Type != domain.ContentPartTypeText {
+		return domain.Message{}, false
+	}
+
+	// Assume the densest script so the cut text is guaranteed to fit
+	keepRunes := int(float64(tokens-counter.messageOverhead-2) * counter.nonASCIICharsPerToken)
+
+	text := []rune(msg.ContentParts[0].Data)
+	if keepRunes <= 0 || keepRunes >= len(text) {
+		return domain.Message{}, false
+	}
+
+	msg.ContentParts = []domain.ContentPart{{
+		Type: domain.ContentPartTypeText,
+		Data: shrunkMessagePrefix + string(text[len(text)-keepRunes:]),
+	}}
+
+	return msg, true
+}
@@ -2,28 +2,140 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
 )
 
+// ImageGenerator draws as many images as the settings ask for.
 type ImageGenerator interface {
-	GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error)
+	GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([][]byte, error)
+}
+
+// ImageEditor redraws a given image as the prompt asks, as many times as the settings ask for.
+type ImageEditor interface {
+	EditImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings) ([][]byte, error)
+}
+
+// ImageUpscaler enlarges an image, restoring the details.
+type ImageUpscaler interface {
+	UpscaleImage(ctx context.Context, image []byte) ([]byte, error)
+}
+
+var ErrEditingUnsupported = errors.New("model can't edit images")
+
+// ImageRoutes finds the providers serving an image model.
+type ImageRoutes interface {
+	ImageGenerator(model string) (ImageGenerator, bool)
+	ImageEditor(model string) (ImageEditor, bool)
 }
 
 type MultiProviderImageClient struct {
-	providers map[string]ImageGenerator
+	providers ImageRoutes
+	fallbacks FallbackChains
 }
 
-func NewMultiProviderImageClient(providers map[string]ImageGenerator) *MultiProviderImageClient {
+func NewMultiProviderImageClient(providers ImageRoutes, fallbacks FallbackChains) *MultiProviderImageClient {
 	return &MultiProviderImageClient{
 		providers: providers,
+		fallbacks: fallbacks,
 	}
 }
 
-func (c *MultiProviderImageClient) GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error) {
-	provider, ok := c.providers[model]
-	if !ok {
-		return nil, fmt.Errorf("no provider found for model: %s", model)
+// GenerateImage draws the images with the model, or with its fallbacks if it fails.
+// The returned images name the model that actually drew them.
+func (c *MultiProviderImageClient) GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([]domain.Image, error) {
+	var err error
+
+	for _, candidate := range c.fallbacks.candidates(model) {
+		provider, ok := c.providers.ImageGenerator(candidate)
+		if !ok {
+			err = fmt.Errorf("no provider found for model: %s", candidate)
+			continue
+		}
+
+		var data [][]byte
+		if data, err = provider.GenerateImage(ctx, prompt, candidate, settings); err == nil {
+			return images(data, candidate), nil
+		}
+
+		if !shouldFallBack(ctx, candidate, err) {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// EditImage redraws the image with the model, or with its fallbacks that can edit
+// images if it fails. The returned images name the model that actually drew them.
+func (c *MultiProviderImageClient) EditImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings) ([]domain.Image, error) {
+	var err error
+
+	for _, candidate := range c.fallbacks.candidates(model) {
+		editor, ok := c.providers.ImageEditor(candidate)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%w: %s", ErrEditingUnsupported, candidate)
+			}
+			continue
+		}
+
+		var data [][]byte
+		if data, err = editor.EditImage(ctx, image, prompt, candidate, settings); err == nil {
+			return images(data, candidate), nil
+		}
+
+		if !shouldFallBack(ctx, candidate, err) {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+func images(data [][]byte, model string) []domain.Image {
+	result := make([]domain.Image, 0, len(data))
+	for _, d := range data {
+		result = append(result, domain.Image{Data: d, Model: model})
+	}
+	return result
+}
+
+// DrawConcurrently calls draw count times at once, for models drawing a single image
+// per request. It returns the images that were drawn, or the first error if none was.
+func DrawConcurrently(ctx context.Context, count int, draw func(ctx context.Context) ([]byte, error)) ([][]byte, error) {
+	count = max(count, 1)
+
+	results := make([][]byte, count)
+	errs := make([]error, count)
+
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = draw(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var images [][]byte
+	for i, err := range errs {
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to draw one of the images", "index", i, logger.Err(err))
+			continue
+		}
+		images = append(images, results[i])
+	}
+
+	if len(images) == 0 {
+		return nil, errs[0]
 	}
 
-	return provider.GenerateImage(ctx, prompt, model)
+	return images, nil
 }
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/samber/lo"
+)
+
+// IntentClassifier tells what the user wants the bot to do with a message.
+type IntentClassifier interface {
+	ClassifyIntent(ctx context.Context, req domain.IntentRequest) (domain.Intent, error)
+}
+
+// intentKeywords are checked in order, so that e.g. "нарисуй" in reply to a photo is an edit.
+var intentKeywords = []struct {
+	intent domain.Intent
+	stems  []string // Matched anywhere, as Russian verbs take prefixes: "нарисуй", "отредактируй"
+	words  []string // Matched at the start of a word only, so that "edit" doesn't match "credit"
+}{
+	{domain.IntentTranscription, []string{"расшифр", "транскриб"}, []string{"transcri"}},
+	{domain.IntentImageEdit, []string{"рисуй", "измени", "редактир"}, []string{"draw", "edit"}},
+	{domain.IntentImageGeneration, []string{"рисуй", "сгенерируй картин", "сгенерируй изображ"}, []string{"draw", "generate an image", "generate a picture"}},
+}
+
+// KeywordClassifier recognizes intents by the words of the message. It needs no
+// model, but can't tell "draw a cat" from "how do I draw a diagram?".
+type KeywordClassifier struct{}
+
+func (KeywordClassifier) ClassifyIntent(_ context.Context, req domain.IntentRequest) (domain.Intent, error) {
+	text := strings.ToLower(req.Text)
+
+	for _, rule := range intentKeywords {
+		matches := lo.SomeBy(rule.stems, func(stem string) bool {
+			return strings.Contains(text, stem)
+		}) || lo.SomeBy(rule.words, func(word string) bool {
+			return startsWord(text, word)
+		})
+		if matches && req.Allows(rule.intent) {
+			return rule.intent, nil
+		}
+	}
+
+	return domain.IntentChat, nil
+}
+
+// startsWord reports whether the text contains word at the start of one of its words.
+func startsWord(text, word string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return false
+		}
+		i += offset
+
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		if i == 0 || !unicode.IsLetter(before) && !unicode.IsDigit(before) {
+			return true
+		}
+		offset = i + len(word)
+	}
+}
+
+// IntentRouter classifies messages with a classifier, falling back to keywords if it
+// fails or names an intent the message doesn't allow.
+type IntentRouter struct {
+	classifier IntentClassifier
+	fallback   KeywordClassifier
+}
+
+// NewIntentRouter creates a router asking the classifier. A nil classifier makes it
+// look for keywords only.
+func NewIntentRouter(classifier IntentClassifier) *IntentRouter {
+	return &IntentRouter{classifier: classifier}
+}
+
+// Classify returns the intent of the message, chat if there is nothing else to it.
+func (r *IntentRouter) Classify(ctx context.Context, req domain.IntentRequest) domain.Intent {
+	if strings.TrimSpace(req.Text) == "" {
+		return domain.IntentChat
+	}
+
+	if r.classifier != nil {
+		intent, err := r.classifier.ClassifyIntent(ctx, req)
+		if err == nil && !req.Allows(intent) {
+			err = fmt.Errorf("intent %q not allowed for the message", intent)
+		}
+		if err == nil {
+			return intent
+		}
+
+		slog.WarnContext(ctx, "Failed to classify intent, looking for keywords", logger.Err(err))
+	}
+
+	intent, _ := r.fallback.ClassifyIntent(ctx, req)
+	return intent
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+func TestKeywordClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		req  domain.IntentRequest
+		want domain.Intent
+	}{
+		{name: "draw", req: domain.IntentRequest{Text: "Draw a cat"}, want: domain.IntentImageGeneration},
+		{name: "russian prefix", req: domain.IntentRequest{Text: "Нарисуй кота"}, want: domain.IntentImageGeneration},
+		{name: "draw inside a word", req: domain.IntentRequest{Text: "How do I withdraw cash?"}, want: domain.IntentChat},
+		{name: "edit with a photo", req: domain.IntentRequest{Text: "edit: make it darker", HasImage: true}, want: domain.IntentImageEdit},
+		{name: "edit inside a word", req: domain.IntentRequest{Text: "Is this a credit card?", HasImage: true}, want: domain.IntentChat},
+		{name: "edit without a photo", req: domain.IntentRequest{Text: "edit my essay"}, want: domain.IntentChat},
+		{name: "transcription", req: domain.IntentRequest{Text: "расшифруй", HasVoice: true}, want: domain.IntentTranscription},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := KeywordClassifier{}.ClassifyIntent(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("ClassifyIntent: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("intent = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type failingClassifier struct{}
+
+func (failingClassifier) ClassifyIntent(context.Context, domain.IntentRequest) (domain.Intent, error) {
+	return "", errors.New("timed out")
+}
+
+func TestIntentRouterFallsBackToKeywords(t *testing.T) {
+	router := NewIntentRouter(failingClassifier{})
+
+	if got := router.Classify(context.Background(), domain.IntentRequest{Text: "draw a cat"}); got != domain.IntentImageGeneration {
+		t.Errorf("intent = %s, want %s", got, domain.IntentImageGeneration)
+	}
+}
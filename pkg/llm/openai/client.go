@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,51 +10,368 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/llm/tools"
+	"github.com/samber/lo"
 )
 
 const (
-	apiURLChatCompletions = "https://api.openai.com/v1/chat/completions"
-	apiURLAudioTranscribe = "https://api.openai.com/v1/audio/transcriptions"
-	apiURLImageGeneration = "https://api.openai.com/v1/images/generations"
+	DefaultBaseURL = "https://api.openai.com/v1"
+
+	pathChatCompletions = "/chat/completions"
+	pathAudioTranscribe = "/audio/transcriptions"
+	pathImageGeneration = "/images/generations"
+	pathImageEdits      = "/images/edits"
+	pathModels          = "/models"
 
-	modelWhisper       = "whisper-1"
 	defaultMaxTokens   = 4096
+	intentMaxTokens    = 20
+	intentTimeout      = 5 * time.Second // Keywords are checked instead of waiting any longer
+	intentModel        = domain.Gpt4oMiniModel
+	reasoningMaxTokens = 25_000 // Reasoning tokens count towards the limit too
 	defaultResponseFmt = "b64_json"
+	maxToolRounds      = 5
+
+	streamDataPrefix  = "data: "
+	streamDoneMarker  = "[DONE]"
+	streamBufferSize  = 64 * 1024
+	streamMaxLineSize = 1024 * 1024
 )
 
 type client struct {
-	token string
-	hc    *http.Client
+	token      string
+	baseURL    string
+	systemRole string
+	tools      *tools.Registry
+	granted    domain.Capabilities
+	hc         *http.Client
+}
+
+type Option func(*client)
+
+// WithTools lets the model call the tools of the registry during chat completions.
+func WithTools(registry *tools.Registry) Option {
+	return func(c *client) {
+		c.tools = registry
+	}
+}
+
+// WithCapabilities grants capabilities to all models of the server on top of what
+// is known about them, e.g. tool support declared for a compatible server.
+func WithCapabilities(granted domain.Capabilities) Option {
+	return func(c *client) {
+		c.granted = granted
+	}
+}
+
+// WithBaseURL points the client at another server, e.g. a proxy or a test server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
 }
 
-func NewClient(token string) (*client, error) {
+// WithHTTPClient replaces the client requests are sent through, e.g. with the client of a test server.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *client) {
+		c.hc = hc
+	}
+}
+
+func NewClient(token string, opts ...Option) (*client, error) {
 	if token == "" {
 		return nil, errors.New("token cannot be empty")
 	}
-	return &client{
-		token: token,
-		hc:    &http.Client{},
-	}, nil
+	c := &client{
+		token:      token,
+		baseURL:    DefaultBaseURL,
+		systemRole: chatMessageRoleDeveloper,
+		hc:         llm.NewHTTPClient(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// NewCompatibleClient creates a client for a server speaking the OpenAI API,
+// such as Ollama, llama.cpp or vLLM. The token is optional for such servers.
+func NewCompatibleClient(baseURL, token string, opts ...Option) (*client, error) {
+	if baseURL == "" {
+		return nil, errors.New("base URL cannot be empty")
+	}
+	c := &client{
+		token:      token,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		systemRole: chatMessageRoleSystem, // Most local servers don't know the developer role
+		hc:         llm.NewHTTPClient(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
+// CreateChatCompletion returns the final answer of the model. When the model calls
+// tools, the tool call and tool result messages are appended to chat.Messages.
 func (c *client) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	return c.runToolLoop(ctx, chat, c.complete)
+}
+
+// CreateChatCompletionStream works like CreateChatCompletion but calls onDelta
+// for every piece of text as it arrives.
+func (c *client) CreateChatCompletionStream(
+	ctx context.Context,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	return c.runToolLoop(ctx, chat, func(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+		return c.completeStream(ctx, chat, onDelta)
+	})
+}
+
+// capabilities returns what the model is known to handle.
+func (c *client) capabilities(model string) domain.Capabilities {
+	return domain.CapabilitiesOf(model).Merge(c.granted)
+}
+
+// runToolLoop requests completions until the model answers without calling tools.
+func (c *client) runToolLoop(
+	ctx context.Context,
+	chat *domain.Chat,
+	complete func(ctx context.Context, chat *domain.Chat) (*domain.Message, error),
+) (*domain.Message, error) {
+	for range maxToolRounds {
+		msg, err := complete(ctx, chat)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(msg.ToolCalls) == 0 || c.tools == nil {
+			return msg, nil
+		}
+
+		chat.Messages = append(chat.Messages, *msg)
+
+		for _, call := range msg.ToolCalls {
+			chat.Messages = append(chat.Messages, domain.Message{
+				Role:         domain.MessageRoleTool,
+				ToolCallID:   call.ID,
+				ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: c.tools.Call(ctx, call.Name, call.Arguments)}},
+			})
+		}
+	}
+
+	return nil, fmt.Errorf("no final answer after %d rounds of tool calls", maxToolRounds)
+}
+
+func (c *client) complete(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	req, err := c.newChatCompletionRequest(ctx, chat, false)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send chat completion request: %w", err)
+	}
+
+	var parsedResp chatCompletionResponse
+	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse chat completion response: %w", err)
+	}
+
+	reportUsage(ctx, chat.TextModel, parsedResp.Usage)
+
+	if len(parsedResp.Choices) == 0 {
+		return nil, errors.New("no choices returned in response")
+	}
+
+	respMessage := parsedResp.Choices[0].Message
+
+	msg := &domain.Message{
+		Role:      respMessage.Role,
+		ToolCalls: fromToolCalls(respMessage.ToolCalls),
+	}
+
+	if text, _ := respMessage.Content.(string); text != "" || len(msg.ToolCalls) == 0 {
+		msg.ContentParts = []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: text}}
+	}
+
+	return msg, nil
+}
+
+func (c *client) completeStream(ctx context.Context, chat *domain.Chat, onDelta func(delta string)) (*domain.Message, error) {
+	req, err := c.newChatCompletionRequest(ctx, chat, true)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.send(req, llm.DefaultRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send chat completion request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	role := chatMessageRoleAssistant
+	var content strings.Builder
+	var calls []toolCall
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, streamBufferSize), streamMaxLineSize)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), streamDataPrefix)
+		if !ok {
+			continue // Skip blank separators and SSE comments
+		}
+
+		if data == streamDoneMarker {
+			break
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse chat completion chunk: %w", err)
+		}
+
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("stream error: %s", chunk.Error.Message)
+		}
+
+		reportUsage(ctx, chat.TextModel, chunk.Usage) // Sent with the last chunk
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta
+		if delta.Role != "" {
+			role = delta.Role
+		}
+
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+
+		// Tool calls arrive in fragments keyed by their index
+		for _, fragment := range delta.ToolCalls {
+			for len(calls) <= fragment.Index {
+				calls = append(calls, toolCall{Type: toolTypeFunction})
+			}
+			call := &calls[fragment.Index]
+			if fragment.ID != "" {
+				call.ID = fragment.ID
+			}
+			call.Function.Name += fragment.Function.Name
+			call.Function.Arguments += fragment.Function.Arguments
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat completion stream: %w", err)
+	}
+
+	msg := &domain.Message{
+		Role:      role,
+		ToolCalls: fromToolCalls(calls),
+	}
+
+	if content.Len() > 0 || len(msg.ToolCalls) == 0 {
+		msg.ContentParts = []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: content.String()}}
+	}
+
+	return msg, nil
+}
+
+func (c *client) newChatCompletionRequest(ctx context.Context, chat *domain.Chat, stream bool) (*http.Request, error) {
+	messages, err := c.toChatCompletionMessages(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	body := chatCompletionRequest{
+		Model:    chat.TextModel,
+		Messages: messages,
+		Stream:   stream,
+	}
+
+	if domain.IsReasoningModel(chat.TextModel) {
+		body.MaxCompletionTokens = reasoningMaxTokens
+		body.ReasoningEffort = chat.Reasoning
+	} else {
+		body.MaxTokens = domain.OutputTokens(chat.TextModel, chat.MaxTokens, defaultMaxTokens)
+		body.Temperature = chat.Temperature
+		body.TopP = chat.TopP
+		body.PresencePenalty = chat.PresencePenalty
+		body.FrequencyPenalty = chat.FrequencyPenalty
+	}
+
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+
+	// Tools are only offered to models known to call them, others reject the request
+	if c.tools != nil && c.capabilities(chat.TextModel).Tools {
+		for _, def := range c.tools.Definitions() {
+			body.Tools = append(body.Tools, toolDefinition{
+				Type: toolTypeFunction,
+				Function: functionDefinition{
+					Name:        def.Name,
+					Description: def.Description,
+					Parameters:  def.Parameters,
+				},
+			})
+		}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathChatCompletions, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+func (c *client) toChatCompletionMessages(chat *domain.Chat) ([]chatCompletionMessage, error) {
 	messages := make([]chatCompletionMessage, 0, len(chat.Messages)+1)
 
-	if chat.SystemPrompt != "" {
+	if instructions := chat.Instructions(); instructions != "" {
 		messages = append(messages, chatCompletionMessage{
-			Role:    chatMessageRoleDeveloper,
-			Content: []chatMessagePart{{Type: chatMessagePartTypeText, Text: chat.SystemPrompt}},
+			Role:    c.systemRole,
+			Content: instructions,
 		})
 	}
 
 	for _, msg := range chat.Messages {
-		if len(msg.ContentParts) == 1 && msg.ContentParts[0].Type == domain.ContentPartTypeText {
+		switch {
+		case len(msg.ToolCalls) > 0:
+			var content any
+			if len(msg.ContentParts) > 0 {
+				content = msg.ContentParts[0].Data
+			}
+			messages = append(messages, chatCompletionMessage{Role: msg.Role, Content: content, ToolCalls: toToolCalls(msg.ToolCalls)})
+		case msg.Role == domain.MessageRoleTool:
+			messages = append(messages, chatCompletionMessage{Role: msg.Role, Content: msg.ContentParts[0].Data, ToolCallID: msg.ToolCallID})
+		case len(msg.ContentParts) == 1 && msg.ContentParts[0].Type == domain.ContentPartTypeText:
 			// Simple text-only case
 			messages = append(messages, chatCompletionMessage{Role: msg.Role, Content: msg.ContentParts[0].Data})
-		} else {
+		default:
 			// Complex content case (multiple parts)
 			var parts []chatMessagePart
 			for _, content := range msg.ContentParts {
@@ -73,55 +391,62 @@ func (c *client) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*
 		}
 	}
 
-	reqBody, err := json.Marshal(chatCompletionRequest{
-		Model:     chat.TextModel,
-		Messages:  messages,
-		MaxTokens: defaultMaxTokens,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
+	return messages, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURLChatCompletions, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+func reportUsage(ctx context.Context, model string, usage *chatCompletionUsage) {
+	if usage == nil {
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	respBody, err := c.doRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send chat completion request: %w", err)
+	var reasoningTokens int
+	if usage.CompletionTokensDetails != nil {
+		reasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
 	}
 
-	var parsedResp chatCompletionResponse
-	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
-		return nil, fmt.Errorf("failed to parse chat completion response: %w", err)
+	llm.ReportUsage(ctx, domain.Usage{
+		Model:           model,
+		InputTokens:     usage.PromptTokens,
+		OutputTokens:    usage.CompletionTokens,
+		ReasoningTokens: reasoningTokens,
+	})
+}
+
+func toToolCalls(calls []domain.ToolCall) []toolCall {
+	result := make([]toolCall, 0, len(calls))
+	for _, call := range calls {
+		result = append(result, toolCall{
+			ID:       call.ID,
+			Type:     toolTypeFunction,
+			Function: functionCall{Name: call.Name, Arguments: call.Arguments},
+		})
 	}
+	return result
+}
 
-	if len(parsedResp.Choices) == 0 {
-		return nil, errors.New("no choices returned in response")
+func fromToolCalls(calls []toolCall) []domain.ToolCall {
+	if len(calls) == 0 {
+		return nil
 	}
 
-	return &domain.Message{
-		Role:         parsedResp.Choices[0].Message.Role,
-		ContentParts: []domain.ContentPart{{Type: "text", Data: fmt.Sprint(parsedResp.Choices[0].Message.Content)}},
-	}, nil
+	result := make([]domain.ToolCall, 0, len(calls))
+	for _, call := range calls {
+		result = append(result, domain.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return result
 }
 
-func (c *client) doRequest(req *http.Request) ([]byte, error) {
-	req.Header.Set("Authorization", "Bearer "+c.token)
-
-	resp, err := c.hc.Do(req)
+func (c *client) doRequest(req *http.Request, policy llm.RetryPolicy) ([]byte, error) {
+	resp, err := c.send(req, policy)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
-	}
-
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
@@ -130,31 +455,48 @@ func (c *client) doRequest(req *http.Request) ([]byte, error) {
 	return respBody, nil
 }
 
+// send performs an authorized request, retrying transient failures as the policy allows, and
+// returns the response when its status is 2xx. The caller is responsible for closing the response body.
+func (c *client) send(req *http.Request, policy llm.RetryPolicy) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return llm.Send(c.hc, req, policy)
+}
+
 func (c *client) TranscribeAudio(ctx context.Context, audioFilePath string) (string, error) {
-	body, contentType, err := createMultipartForm(audioFilePath, modelWhisper)
+	body, contentType, err := createMultipartForm(audioFilePath, domain.WhisperModel)
 	if err != nil {
 		return "", fmt.Errorf("failed to create multipart form: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURLAudioTranscribe, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathAudioTranscribe, body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 	req.Header.Set("Content-Type", contentType)
 
-	respBody, err := c.doRequest(req)
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
 	if err != nil {
 		return "", fmt.Errorf("failed to transcribe audio: %w", err)
 	}
 
 	var parsedResp struct {
-		Text string `json:"text"`
+		Text  string `json:"text"`
+		Usage *struct {
+			Seconds float64 `json:"seconds"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
 		return "", fmt.Errorf("failed to parse transcription response: %w", err)
 	}
 
+	if parsedResp.Usage != nil {
+		llm.ReportUsage(ctx, domain.Usage{Model: domain.WhisperModel, AudioSeconds: parsedResp.Usage.Seconds})
+	}
+
 	return parsedResp.Text, nil
 }
 
@@ -187,57 +529,210 @@ func createMultipartForm(filePath, model string) (*bytes.Buffer, string, error)
 	return &body, writer.FormDataContentType(), nil
 }
 
-func (c *client) GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error) {
+// ListModels returns the chat and image models available to the account.
+// Audio, embedding, moderation and other models the bot can't use are left out.
+func (c *client) ListModels(ctx context.Context) ([]domain.ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+pathModels, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	var parsedResp listModelsResponse
+	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse models response: %w", err)
+	}
+
+	var result []domain.ModelInfo
+	for _, model := range parsedResp.Data {
+		if kind, ok := modelKind(model.ID); ok {
+			result = append(result, domain.ModelInfo{ID: model.ID, Kind: kind})
+		}
+	}
+
+	return result, nil
+}
+
+// modelKind tells chat and image models apart by their names. Models served by the
+// Responses API only, such as o1-pro or codex-mini, can't chat through this client.
+func modelKind(id string) (domain.ModelKind, bool) {
+	switch {
+	case strings.HasPrefix(id, "dall-e"), strings.HasPrefix(id, "gpt-image"):
+		return domain.ModelKindImage, true
+	case lo.SomeBy([]string{
+		"audio", "realtime", "transcribe", "tts", "search", "instruct", "embedding",
+		"-pro", "codex", "computer-use", "deep-research",
+	}, func(s string) bool {
+		return strings.Contains(id, s)
+	}):
+		return "", false
+	case strings.HasPrefix(id, "gpt-"), strings.HasPrefix(id, "chatgpt-"), domain.IsReasoningModel(id):
+		return domain.ModelKindText, true
+	default:
+		return "", false
+	}
+}
+
+// GenerateImage draws as many images as the settings ask for. DALL-E 3 draws a single
+// image per request, so it is asked several times at once.
+func (c *client) GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
 	if model == "" {
 		model = domain.DallE2Model
 	}
 
-	size := size256x256
-	quality := qualityStandard
-
 	if model == domain.DallE3Model {
-		size = size1024x1024
-		quality = qualityHD
+		return llm.DrawConcurrently(ctx, settings.ImageCount(), func(ctx context.Context) ([]byte, error) {
+			images, err := c.generateImages(ctx, prompt, model, settings, 1)
+			if err != nil {
+				return nil, err
+			}
+			return images[0], nil
+		})
 	}
 
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"model":           model,
-		"prompt":          prompt,
-		"n":               1,
-		"size":            size,
-		"quality":         quality,
-		"response_format": defaultResponseFmt,
-	})
+	return c.generateImages(ctx, prompt, model, settings, settings.ImageCount())
+}
+
+func (c *client) generateImages(ctx context.Context, prompt string, model string, settings domain.ImageSettings, n int) ([][]byte, error) {
+	size, quality := imageOptions(model, settings)
+
+	body := map[string]interface{}{
+		"model":   model,
+		"prompt":  prompt,
+		"n":       n,
+		"size":    size,
+		"quality": quality,
+	}
+
+	// GPT Image models always answer with base64
+	if model != domain.GptImage1Model {
+		body["response_format"] = defaultResponseFmt
+	}
+
+	reqBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURLImageGeneration, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathImageGeneration, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	respBody, err := c.doRequest(req)
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate image: %w", err)
 	}
 
-	var parsedResp struct {
-		Data []struct {
-			B64Json []byte `json:"b64_json"`
-		} `json:"data"`
+	return parseImageResponse(ctx, respBody, model, domain.ImagePriceOf(model, string(size), string(quality)))
+}
+
+// EditImage redraws the image as the prompt asks. Only GPT Image models edit
+// images without a mask.
+func (c *client) EditImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
+	if model != domain.GptImage1Model {
+		return nil, fmt.Errorf("%w: %s", llm.ErrEditingUnsupported, model)
 	}
 
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="image"; filename="image"`)
+	header.Set("Content-Type", http.DetectContentType(image))
+
+	imageWriter, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := imageWriter.Write(image); err != nil {
+		return nil, fmt.Errorf("failed to write image: %w", err)
+	}
+
+	size, quality := imageOptions(model, settings)
+
+	for field, value := range map[string]string{
+		"model":   model,
+		"prompt":  prompt,
+		"n":       strconv.Itoa(settings.ImageCount()),
+		"size":    string(size),
+		"quality": string(quality),
+	} {
+		if err := writer.WriteField(field, value); err != nil {
+			return nil, fmt.Errorf("failed to write %s field: %w", field, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathImageEdits, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit image: %w", err)
+	}
+
+	return parseImageResponse(ctx, respBody, model, domain.ImagePriceOf(model, string(size), string(quality)))
+}
+
+// imageOptions maps the image settings to the nearest size and quality the model supports.
+// DALL-E 2 draws squares of three sizes only, the other models draw a single size per orientation.
+func imageOptions(model string, settings domain.ImageSettings) (imageSize, imageQuality) {
+	switch model {
+	case domain.DallE3Model:
+		sizes := map[int]imageSize{1: size1792x1024, 0: size1024x1024, -1: size1024x1792}
+		if settings.Quality == domain.ImageQualityStandard {
+			return sizes[settings.Orientation()], qualityStandard
+		}
+		return sizes[settings.Orientation()], qualityHD
+	case domain.GptImage1Model:
+		sizes := map[int]imageSize{1: size1536x1024, 0: size1024x1024, -1: size1024x1536}
+		if settings.Quality == domain.ImageQualityHD {
+			return sizes[settings.Orientation()], qualityHigh
+		}
+		return sizes[settings.Orientation()], qualityMedium
+	default:
+		switch settings.Size {
+		case domain.ImageSizeLarge:
+			return size1024x1024, qualityStandard
+		case domain.ImageSizeMedium:
+			return size512x512, qualityStandard
+		default:
+			return size256x256, qualityStandard
+		}
+	}
+}
+
+// parseImageResponse reads the drawn images, each of which costs imagePrice.
+func parseImageResponse(ctx context.Context, respBody []byte, model string, imagePrice float64) ([][]byte, error) {
+	var parsedResp imageResponse
 	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
-		return nil, fmt.Errorf("failed to parse image generation response: %w", err)
+		return nil, fmt.Errorf("failed to parse image response: %w", err)
 	}
 
 	if len(parsedResp.Data) == 0 {
 		return nil, errors.New("no image data returned")
 	}
 
-	return parsedResp.Data[0].B64Json, nil
+	llm.ReportUsage(ctx, domain.Usage{Model: model, Images: len(parsedResp.Data), ImagePrice: imagePrice})
+
+	images := make([][]byte, 0, len(parsedResp.Data))
+	for _, data := range parsedResp.Data {
+		images = append(images, data.B64Json)
+	}
+
+	return images, nil
 }
 
 func (c *client) GenerateImagePrompt(ctx context.Context, prompt string) (string, error) {
@@ -252,13 +747,13 @@ func (c *client) GenerateImagePrompt(ctx context.Context, prompt string) (string
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURLChatCompletions, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathChatCompletions, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	respBody, err := c.doRequest(req)
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
 	if err != nil {
 		return "", fmt.Errorf("failed to send chat completion request: %w", err)
 	}
@@ -268,9 +763,91 @@ func (c *client) GenerateImagePrompt(ctx context.Context, prompt string) (string
 		return "", fmt.Errorf("failed to parse chat completion response: %w", err)
 	}
 
+	reportUsage(ctx, domain.Gpt4oMiniModel, parsedResp.Usage)
+
 	if len(parsedResp.Choices) == 0 {
 		return "", errors.New("no choices returned in response")
 	}
 
 	return fmt.Sprint(parsedResp.Choices[0].Message.Content), nil
 }
+
+// ClassifyIntent asks a cheap model what the user wants the bot to do with the message,
+// constraining the answer to the known intents if the model supports JSON mode. The model
+// gets a few seconds and a single attempt, as the caller has keywords to fall back to.
+func (c *client) ClassifyIntent(ctx context.Context, req domain.IntentRequest) (domain.Intent, error) {
+	const instructions = `Classify what the user of a Telegram bot wants it to do with their message:
+- chat: answer, explain or discuss, including questions about drawing or images
+- image_generation: draw a new picture
+- image_edit: change the attached photo
+- transcription: write down the speech of the voice message replied to
+Answer with a JSON object such as {"intent":"chat"}.`
+
+	ctx, cancel := context.WithTimeout(ctx, intentTimeout)
+	defer cancel()
+
+	content := fmt.Sprintf("Message: %s\nPhoto attached: %t\nReplies to a voice message: %t", req.Text, req.HasImage, req.HasVoice)
+
+	body := chatCompletionRequest{
+		Model: intentModel,
+		Messages: []chatCompletionMessage{
+			{Role: "system", Content: instructions},
+			{Role: "user", Content: content},
+		},
+		MaxTokens: intentMaxTokens,
+	}
+
+	if c.capabilities(intentModel).JSONMode {
+		body.ResponseFormat = &responseFormat{
+			Type: "json_schema",
+			JSONSchema: jsonSchema{
+				Name:   "intent",
+				Strict: true,
+				Schema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"intent": map[string]interface{}{"type": "string", "enum": domain.Intents},
+					},
+					"required":             []string{"intent"},
+					"additionalProperties": false,
+				},
+			},
+		}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+pathChatCompletions, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	respBody, err := c.doRequest(httpReq, llm.NoRetryPolicy)
+	if err != nil {
+		return "", fmt.Errorf("failed to send chat completion request: %w", err)
+	}
+
+	var parsedResp chatCompletionResponse
+	if err := json.Unmarshal(respBody, &parsedResp); err != nil {
+		return "", fmt.Errorf("failed to parse chat completion response: %w", err)
+	}
+
+	reportUsage(ctx, intentModel, parsedResp.Usage)
+
+	if len(parsedResp.Choices) == 0 {
+		return "", errors.New("no choices returned in response")
+	}
+
+	var answer struct {
+		Intent domain.Intent `json:"intent"`
+	}
+	if err := json.Unmarshal([]byte(fmt.Sprint(parsedResp.Choices[0].Message.Content)), &answer); err != nil {
+		return "", fmt.Errorf("failed to parse intent: %w", err)
+	}
+
+	return answer.Intent, nil
+}
@@ -0,0 +1,259 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/llm/tools"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient("test-token", WithBaseURL(srv.URL), WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	return c
+}
+
+func testChat() *domain.Chat {
+	return &domain.Chat{
+		TextModel: domain.Gpt4oMiniModel,
+		Messages: []domain.Message{{
+			Role:         domain.MessageRoleUser,
+			ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: "Hello"}},
+		}},
+	}
+}
+
+func writeAnswer(t *testing.T, w http.ResponseWriter, text string) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": text}}},
+	}); err != nil {
+		t.Errorf("encode response: %v", err)
+	}
+}
+
+func TestCreateChatCompletion(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != pathChatCompletions {
+			t.Errorf("path = %s, want %s", r.URL.Path, pathChatCompletions)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		var req chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.Model != domain.Gpt4oMiniModel {
+			t.Errorf("model = %s, want %s", req.Model, domain.Gpt4oMiniModel)
+		}
+
+		writeAnswer(t, w, "Hi there")
+	})
+
+	msg, err := c.CreateChatCompletion(context.Background(), testChat())
+	if err != nil {
+		t.Fatalf("CreateChatCompletion: %v", err)
+	}
+	if got := msg.ContentParts[0].Data; got != "Hi there" {
+		t.Errorf("answer = %q, want %q", got, "Hi there")
+	}
+}
+
+func TestCreateChatCompletionRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		writeAnswer(t, w, "Hi there")
+	})
+
+	if _, err := c.CreateChatCompletion(context.Background(), testChat()); err != nil {
+		t.Fatalf("CreateChatCompletion: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestCreateChatCompletionQuotaExceeded(t *testing.T) {
+	attempts := 0
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		http.Error(w, `{"error":{"code":"insufficient_quota"}}`, http.StatusTooManyRequests)
+	})
+
+	_, err := c.CreateChatCompletion(context.Background(), testChat())
+	if !errors.Is(err, llm.ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want %v", err, llm.ErrQuotaExceeded)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestCreateChatCompletionCapsMaxTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		maxTokens int
+		want      int
+	}{
+		{name: "default", model: domain.Gpt4oMiniModel, want: defaultMaxTokens},
+		{name: "within the model limit", model: domain.Gpt4oMiniModel, maxTokens: 16384, want: 16384},
+		{name: "above the model limit", model: domain.Gpt35TurboModel, maxTokens: 16384, want: 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				var req chatCompletionRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("decode request: %v", err)
+				}
+				if req.MaxTokens != tt.want {
+					t.Errorf("max_tokens = %d, want %d", req.MaxTokens, tt.want)
+				}
+				writeAnswer(t, w, "Hi there")
+			})
+
+			chat := testChat()
+			chat.TextModel = tt.model
+			chat.MaxTokens = tt.maxTokens
+			if _, err := c.CreateChatCompletion(context.Background(), chat); err != nil {
+				t.Fatalf("CreateChatCompletion: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateChatCompletionOffersToolsToCapableModels(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		granted   domain.Capabilities
+		wantTools bool
+	}{
+		{name: "known to call tools", model: domain.Gpt4oMiniModel, wantTools: true},
+		{name: "known not to", model: "o1-mini", wantTools: false},
+		{name: "unknown", model: "llama3.1", wantTools: false},
+		{name: "granted", model: "llama3.1", granted: domain.Capabilities{Tools: true}, wantTools: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req chatCompletionRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("decode request: %v", err)
+				}
+				if got := len(req.Tools) > 0; got != tt.wantTools {
+					t.Errorf("tools sent = %v, want %v", got, tt.wantTools)
+				}
+				writeAnswer(t, w, "Hi there")
+			}))
+			t.Cleanup(srv.Close)
+
+			c, err := NewCompatibleClient(srv.URL, "", WithHTTPClient(srv.Client()), WithTools(tools.Builtin()), WithCapabilities(tt.granted))
+			if err != nil {
+				t.Fatalf("NewCompatibleClient: %v", err)
+			}
+
+			chat := testChat()
+			chat.TextModel = tt.model
+			if _, err := c.CreateChatCompletion(context.Background(), chat); err != nil {
+				t.Fatalf("CreateChatCompletion: %v", err)
+			}
+		})
+	}
+}
+
+func TestListModels(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"id":"gpt-4o-mini"},{"id":"o1-pro"},{"id":"gpt-4o-realtime-preview"},{"id":"dall-e-3"},{"id":"text-embedding-3-small"}]}`))
+	})
+
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+
+	got := map[string]domain.ModelKind{}
+	for _, m := range models {
+		got[m.ID] = m.Kind
+	}
+	want := map[string]domain.ModelKind{"gpt-4o-mini": domain.ModelKindText, "dall-e-3": domain.ModelKindImage}
+	if !maps.Equal(got, want) {
+		t.Errorf("models = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateImageReportsPriceOfSentOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		settings domain.ImageSettings
+		want     float64
+	}{
+		{name: "dall-e-3 standard", model: domain.DallE3Model, settings: domain.ImageSettings{Quality: domain.ImageQualityStandard}, want: 0.04},
+		{name: "dall-e-3 hd landscape", model: domain.DallE3Model, settings: domain.ImageSettings{AspectRatio: "16:9", Quality: domain.ImageQualityHD}, want: 0.12},
+		{name: "gpt-image-1 hd portrait", model: domain.GptImage1Model, settings: domain.ImageSettings{AspectRatio: "2:3", Quality: domain.ImageQualityHD}, want: 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(`{"data":[{"b64_json":"aW1hZ2U="}]}`))
+			})
+
+			ctx, usages := llm.ContextWithUsageCollector(context.Background())
+			if _, err := c.GenerateImage(ctx, "a cat", tt.model, tt.settings); err != nil {
+				t.Fatalf("GenerateImage: %v", err)
+			}
+
+			reported := usages.Usages()
+			if len(reported) != 1 {
+				t.Fatalf("usages = %v, want one", reported)
+			}
+			if got := domain.PriceOf(tt.model).Cost(reported[0]); got != tt.want {
+				t.Errorf("cost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyIntentIsNotRetried(t *testing.T) {
+	attempts := 0
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	})
+
+	if _, err := c.ClassifyIntent(context.Background(), domain.IntentRequest{Text: "draw a cat"}); err == nil {
+		t.Fatal("ClassifyIntent succeeded, want the error for the caller to fall back")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
@@ -1,22 +1,120 @@
 package openai
 
+import "encoding/json"
+
 type chatCompletionRequest struct {
 	Model     string                  `json:"model"`
 	Messages  []chatCompletionMessage `json:"messages"`
-	MaxTokens int                     `json:"max_tokens"`
+	MaxTokens int                     `json:"max_tokens,omitempty"`
+	Stream    bool                    `json:"stream,omitempty"`
+	Tools     []toolDefinition        `json:"tools,omitempty"`
+
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+
+	// Reasoning models reject max_tokens and sampling parameters and take these instead
+	MaxCompletionTokens int    `json:"max_completion_tokens,omitempty"`
+	ReasoningEffort     string `json:"reasoning_effort,omitempty"`
+
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// responseFormat makes the model answer with JSON matching the schema.
+type responseFormat struct {
+	Type       string     `json:"type"`
+	JSONSchema jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
 }
 
 type chatCompletionResponse struct {
 	Choices []chatCompletionChoice `json:"choices"`
+	Usage   *chatCompletionUsage   `json:"usage"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens            int                     `json:"prompt_tokens"`
+	CompletionTokens        int                     `json:"completion_tokens"`
+	CompletionTokensDetails *completionTokensDetail `json:"completion_tokens_details,omitempty"`
+}
+
+type completionTokensDetail struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
 }
 
 type chatCompletionChoice struct {
 	Message chatCompletionMessage `json:"message"`
 }
 
+type chatCompletionChunk struct {
+	Choices []chatCompletionChunkChoice `json:"choices"`
+	Usage   *chatCompletionUsage        `json:"usage"`
+	Error   *apiError                   `json:"error,omitempty"`
+}
+
+type chatCompletionChunkChoice struct {
+	Delta        chatCompletionDelta `json:"delta"`
+	FinishReason string              `json:"finish_reason"`
+}
+
+type chatCompletionDelta struct {
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	ToolCalls []toolCallDelta `json:"tool_calls"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+}
+
 type chatCompletionMessage struct {
-	Role    string `json:"role"`
-	Content any    `json:"content"`
+	Role       string     `json:"role"`
+	Content    any        `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+const toolTypeFunction = "function"
+
+type toolDefinition struct {
+	Type     string             `json:"type"`
+	Function functionDefinition `json:"function"`
+}
+
+type functionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type toolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function functionCall `json:"function"`
+}
+
+type functionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type toolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id"`
+	Function functionCall `json:"function"`
 }
 
 type chatMessagePartType string
@@ -36,7 +134,11 @@ type chatMessageImageURL struct {
 	URL string `json:"url,omitempty"`
 }
 
-const chatMessageRoleDeveloper = "developer"
+const (
+	chatMessageRoleDeveloper = "developer"
+	chatMessageRoleSystem    = "system"
+	chatMessageRoleAssistant = "assistant"
+)
 
 type imageSize string
 
@@ -46,6 +148,8 @@ const (
 	size1024x1024 imageSize = "1024x1024"
 	size1024x1792 imageSize = "1024x1792"
 	size1792x1024 imageSize = "1792x1024"
+	size1536x1024 imageSize = "1536x1024"
+	size1024x1536 imageSize = "1024x1536"
 )
 
 type imageQuality string
@@ -53,4 +157,18 @@ type imageQuality string
 const (
 	qualityStandard imageQuality = "standard"
 	qualityHD       imageQuality = "hd"
+	qualityMedium   imageQuality = "medium" // GPT Image models only
+	qualityHigh     imageQuality = "high"   // GPT Image models only
 )
+
+type imageResponse struct {
+	Data []struct {
+		B64Json []byte `json:"b64_json"`
+	} `json:"data"`
+}
+
+type listModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+type QuotaProvider interface {
+	Get(ctx context.Context, userID int64) (*domain.Quota, error)
+}
+
+type SpendProvider interface {
+	UserTotal(ctx context.Context, userID int64, since time.Time) (float64, error)
+	Total(ctx context.Context, since time.Time) (float64, error)
+}
+
+// QuotaGuard makes sure that users don't spend more on models than their quotas allow.
+// Users without a quota of their own get the default one. A non-zero global monthly
+// limit caps the monthly spend of all users together.
+type QuotaGuard struct {
+	quotas             QuotaProvider
+	spend              SpendProvider
+	defaultQuota       domain.Quota
+	globalMonthlyLimit float64
+}
+
+func NewQuotaGuard(quotas QuotaProvider, spend SpendProvider, defaultQuota domain.Quota, globalMonthlyLimit float64) *QuotaGuard {
+	return &QuotaGuard{
+		quotas:             quotas,
+		spend:              spend,
+		defaultQuota:       defaultQuota,
+		globalMonthlyLimit: globalMonthlyLimit,
+	}
+}
+
+// Check returns a *domain.QuotaExhaustedError if the user has spent any of the limits by now.
+func (g *QuotaGuard) Check(ctx context.Context, userID int64, now time.Time) error {
+	quota, err := g.userQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	limits := []struct {
+		scope domain.QuotaScope
+		limit float64
+		since time.Time
+		reset time.Time
+		spent func(since time.Time) (float64, error)
+	}{
+		{
+			scope: domain.QuotaScopeDaily, limit: quota.Daily,
+			since: domain.StartOfDay(now), reset: domain.StartOfDay(now).AddDate(0, 0, 1),
+			spent: func(since time.Time) (float64, error) { return g.spend.UserTotal(ctx, userID, since) },
+		},
+		{
+			scope: domain.QuotaScopeMonthly, limit: quota.Monthly,
+			since: domain.StartOfMonth(now), reset: domain.StartOfMonth(now).AddDate(0, 1, 0),
+			spent: func(since time.Time) (float64, error) { return g.spend.UserTotal(ctx, userID, since) },
+		},
+		{
+			scope: domain.QuotaScopeGlobal, limit: g.globalMonthlyLimit,
+			since: domain.StartOfMonth(now), reset: domain.StartOfMonth(now).AddDate(0, 1, 0),
+			spent: func(since time.Time) (float64, error) { return g.spend.Total(ctx, since) },
+		},
+	}
+
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+
+		spent, err := l.spent(l.since)
+		if err != nil {
+			return err
+		}
+
+		if spent >= l.limit {
+			return &domain.QuotaExhaustedError{Scope: l.scope, Spent: spent, Limit: l.limit, Reset: l.reset}
+		}
+	}
+
+	return nil
+}
+
+func (g *QuotaGuard) userQuota(ctx context.Context, userID int64) (domain.Quota, error) {
+	quota, err := g.quotas.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return g.defaultQuota, nil
+		}
+		return domain.Quota{}, err
+	}
+	return *quota, nil
+}
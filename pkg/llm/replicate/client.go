@@ -3,76 +3,249 @@ package replicate
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/samber/lo"
 )
 
 const (
-	apiURL                 = "https://api.replicate.com/v1"
-	apiURLPredictions      = apiURL + "/predictions"
-	apiURLModels           = apiURL + "/models"
+	DefaultBaseURL = "https://api.replicate.com/v1"
+
+	pathPredictions        = "/predictions"
+	pathModels             = "/models"
 	defaultPollingTimeout  = 60 * time.Second
 	defaultPollingInterval = 1 * time.Second
 )
 
 type client struct {
-	token string
-	hc    *http.Client
+	token         string
+	baseURL       string
+	hc            *http.Client
+	models        Models
+	webhookURL    string
+	webhookSecret string
+}
+
+type Option func(*client)
+
+// WithHTTPClient replaces the client requests are sent through, e.g. with the client of a test server.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *client) {
+		c.hc = hc
+	}
 }
 
-func NewClient(token string) (*client, error) {
+// WithModels makes the client offer the models instead of DefaultModels.
+func WithModels(models Models) Option {
+	return func(c *client) {
+		c.models = models
+	}
+}
+
+// WithWebhook makes Replicate post submitted predictions to the URL once they complete,
+// rather than only have them polled. Posted predictions are verified with the signing secret.
+func WithWebhook(url, secret string) Option {
+	return func(c *client) {
+		c.webhookURL = url
+		c.webhookSecret = secret
+	}
+}
+
+func NewClient(token, baseURL string, opts ...Option) (*client, error) {
 	if token == "" {
 		return nil, errors.New("token cannot be empty")
 	}
-	return &client{
-		token: token,
-		hc:    &http.Client{},
-	}, nil
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	c := &client{
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      llm.NewHTTPClient(),
+		models:  DefaultModels,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	for _, spec := range c.models {
+		if err := spec.validate(); err != nil {
+			return nil, fmt.Errorf("invalid model: %w", err)
+		}
+	}
+	return c, nil
 }
 
-func (c *client) GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error) {
-	// Map domain model to Replicate model
-	replicateModel, ok := ModelToReplicateModel[model]
+// ListModels returns the models of the registry. Models with an image input edit images.
+func (c *client) ListModels(_ context.Context) ([]domain.ModelInfo, error) {
+	return lo.Map(c.models, func(spec ModelSpec, _ int) domain.ModelInfo {
+		return domain.ModelInfo{
+			ID:      spec.ID,
+			Name:    spec.Name,
+			Kind:    domain.ModelKindImage,
+			Editing: spec.Inputs.Image != "",
+			Price:   domain.Price{PerImage: spec.PricePerImage},
+		}
+	}), nil
+}
+
+// GenerateImage draws as many images as the settings ask for, in a single prediction
+// if the model can draw several images at once and in concurrent ones otherwise.
+func (c *client) GenerateImage(ctx context.Context, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
+	spec, ok := c.model(model)
 	if !ok {
 		return nil, fmt.Errorf("unsupported model: %s", model)
 	}
 
-	predictionURL := fmt.Sprintf("%s/%s/predictions", apiURLModels, replicateModel)
+	return c.draw(ctx, spec, prompt, nil, settings)
+}
 
-	input := FluxInput{
-		Prompt:      prompt,
-		AspectRatio: DefaultAspectRatio,
+// EditImage passes the image to the model input meant for it, as a data URL.
+func (c *client) EditImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings) ([][]byte, error) {
+	spec, ok := c.model(model)
+	if !ok || spec.Inputs.Image == "" {
+		return nil, fmt.Errorf("%w: %s", llm.ErrEditingUnsupported, model)
 	}
 
-	reqBody, err := json.Marshal(CreatePredictionRequest{
-		Input: map[string]interface{}{
-			"prompt":       input.Prompt,
-			"aspect_ratio": input.AspectRatio,
-		},
+	return c.draw(ctx, spec, prompt, image, settings)
+}
+
+// UpscaleImage enlarges the image with Real-ESRGAN.
+func (c *client) UpscaleImage(ctx context.Context, image []byte) ([]byte, error) {
+	images, err := c.predict(ctx, realESRGAN, map[string]interface{}{
+		realESRGAN.Inputs.Image: dataURL(image),
+		"scale":                 UpscaleFactor,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, predictionURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	return images[0], nil
+}
+
+// SubmitImage starts the predictions drawing the images without waiting for them. Every
+// prediction is passed to submitted once created, and no more are created if it fails.
+func (c *client) SubmitImage(
+	ctx context.Context,
+	image []byte,
+	prompt string,
+	model string,
+	settings domain.ImageSettings,
+	submitted func(predictionID string) error,
+) ([]string, error) {
+	spec, ok := c.model(model)
+	if !ok {
+		return nil, fmt.Errorf("unsupported model: %s", model)
+	}
+	if image != nil && spec.Inputs.Image == "" {
+		return nil, fmt.Errorf("%w: %s", llm.ErrEditingUnsupported, model)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "wait") // Wait for the prediction to complete
 
-	respBody, err := c.doRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create prediction: %w", err)
+	predictions, perPrediction := settings.ImageCount(), 1
+	if spec.Inputs.NumOutputs != "" {
+		predictions, perPrediction = 1, settings.ImageCount()
+	}
+
+	var predictionIDs []string
+	for range predictions {
+		prediction, err := c.createPrediction(ctx, spec, spec.input(prompt, image, settings, perPrediction), false)
+		if err != nil {
+			return predictionIDs, err
+		}
+		predictionIDs = append(predictionIDs, prediction.ID)
+
+		if err := submitted(prediction.ID); err != nil {
+			return predictionIDs, err
+		}
+	}
+
+	return predictionIDs, nil
+}
+
+// ParsePrediction verifies the signature of a posted webhook and reads the prediction in it.
+func (c *client) ParsePrediction(header http.Header, body []byte) (*domain.Prediction, error) {
+	if err := VerifyWebhook(c.webhookSecret, header, body, time.Now()); err != nil {
+		return nil, err
 	}
 
 	var prediction ReplicatePrediction
-	if err := json.Unmarshal(respBody, &prediction); err != nil {
-		return nil, fmt.Errorf("failed to parse prediction response: %w", err)
+	if err := json.Unmarshal(body, &prediction); err != nil {
+		return nil, fmt.Errorf("failed to parse prediction: %w", err)
+	}
+
+	return toPrediction(prediction), nil
+}
+
+// GetPrediction fetches a submitted prediction, e.g. one that completed while the bot was down.
+func (c *client) GetPrediction(ctx context.Context, predictionID string) (*domain.Prediction, error) {
+	prediction, err := c.getPrediction(ctx, predictionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prediction: %w", err)
+	}
+
+	return toPrediction(prediction), nil
+}
+
+// PredictionImages downloads the images output by a posted prediction of the model.
+func (c *client) PredictionImages(ctx context.Context, model string, prediction *domain.Prediction) ([][]byte, error) {
+	if prediction.Err != nil {
+		return nil, prediction.Err
+	}
+
+	spec, ok := c.model(model)
+	if !ok {
+		return nil, fmt.Errorf("unsupported model: %s", model)
+	}
+
+	return c.downloadOutput(ctx, spec, prediction.Output)
+}
+
+func (c *client) model(id string) (ModelSpec, bool) {
+	return lo.Find(c.models, func(spec ModelSpec) bool { return spec.ID == id })
+}
+
+func (c *client) draw(ctx context.Context, spec ModelSpec, prompt string, image []byte, settings domain.ImageSettings) ([][]byte, error) {
+	count := settings.ImageCount()
+
+	if spec.Inputs.NumOutputs != "" {
+		return c.predict(ctx, spec, spec.input(prompt, image, settings, count))
+	}
+
+	return llm.DrawConcurrently(ctx, count, func(ctx context.Context) ([]byte, error) {
+		images, err := c.predict(ctx, spec, spec.input(prompt, image, settings, 1))
+		if err != nil {
+			return nil, err
+		}
+		return images[0], nil
+	})
+}
+
+func dataURL(image []byte) string {
+	return "data:" + http.DetectContentType(image) + ";base64," + base64.StdEncoding.EncodeToString(image)
+}
+
+// outputFormat keeps HD images lossless.
+func outputFormat(settings domain.ImageSettings) string {
+	if settings.Quality == domain.ImageQualityHD {
+		return OutputFormatPNG
+	}
+	return OutputFormatJPG
+}
+
+// predict runs the model on the input, waits for the prediction to complete and downloads
+// the images it outputs.
+func (c *client) predict(ctx context.Context, spec ModelSpec, input map[string]interface{}) ([][]byte, error) {
+	prediction, err := c.createPrediction(ctx, spec, input, true)
+	if err != nil {
+		return nil, err
 	}
 
 	// If the prediction is not completed, poll for the result
@@ -83,36 +256,138 @@ func (c *client) GenerateImage(ctx context.Context, prompt string, model string)
 		}
 	}
 
-	if prediction.Status != PredictionStatusSucceeded {
-		return nil, fmt.Errorf("prediction failed with status %s: %s", prediction.Status, prediction.Error)
+	if err := predictionError(prediction); err != nil {
+		return nil, err
 	}
 
-	if len(prediction.Output) == 0 {
-		return nil, errors.New("no output returned")
+	return c.downloadOutput(ctx, spec, prediction.Output)
+}
+
+// createPrediction starts running the model on the input. Models with a version are run
+// by it, others by their slug. If asked to, Replicate waits a while for the prediction to
+// complete, otherwise it posts the prediction to the webhook, if any, once it completes.
+func (c *client) createPrediction(ctx context.Context, spec ModelSpec, input map[string]interface{}, wait bool) (ReplicatePrediction, error) {
+	predictionURL := fmt.Sprintf("%s%s/%s/predictions", c.baseURL, pathModels, spec.Slug)
+	if spec.Version != "" {
+		predictionURL = c.baseURL + pathPredictions
 	}
 
-	imageData, err := c.downloadImage(ctx, prediction.Output)
+	predictionReq := CreatePredictionRequest{
+		Version: spec.Version,
+		Input:   input,
+	}
+	if !wait && c.webhookURL != "" {
+		predictionReq.Webhook = c.webhookURL
+		predictionReq.WebhookEventsFilter = []string{WebhookEventCompleted}
+	}
+
+	reqBody, err := json.Marshal(predictionReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download image: %w", err)
+		return ReplicatePrediction{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	return imageData, nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, predictionURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return ReplicatePrediction{}, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wait {
+		req.Header.Set("Prefer", "wait") // Wait for the prediction to complete
+	}
+
+	respBody, err := c.doRequest(req, llm.CreateRetryPolicy)
+	if err != nil {
+		return ReplicatePrediction{}, fmt.Errorf("failed to create prediction: %w", err)
+	}
+
+	var prediction ReplicatePrediction
+	if err := json.Unmarshal(respBody, &prediction); err != nil {
+		return ReplicatePrediction{}, fmt.Errorf("failed to parse prediction response: %w", err)
+	}
+
+	return prediction, nil
+}
+
+// downloadOutput downloads the images output by a prediction of the model.
+func (c *client) downloadOutput(ctx context.Context, spec ModelSpec, output json.RawMessage) ([][]byte, error) {
+	imageURLs, err := outputURLs(output, spec.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	var images [][]byte
+	for _, imageURL := range imageURLs {
+		imageData, err := c.downloadImage(ctx, imageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download image: %w", err)
+		}
+		images = append(images, imageData)
+	}
+
+	llm.ReportUsage(ctx, domain.Usage{Model: spec.ID, Images: len(images), ImagePrice: spec.PricePerImage})
+
+	return images, nil
 }
 
-func (c *client) doRequest(req *http.Request) ([]byte, error) {
+func toPrediction(prediction ReplicatePrediction) *domain.Prediction {
+	return &domain.Prediction{
+		ID:     prediction.ID,
+		Done:   isDone(prediction),
+		Output: prediction.Output,
+		Err:    predictionError(prediction),
+	}
+}
+
+func isDone(prediction ReplicatePrediction) bool {
+	return prediction.Status == PredictionStatusSucceeded ||
+		prediction.Status == PredictionStatusFailed ||
+		prediction.Status == PredictionStatusCanceled
+}
+
+// predictionError explains why the prediction didn't succeed, nil if it did.
+func predictionError(prediction ReplicatePrediction) error {
+	switch {
+	case prediction.Status == PredictionStatusSucceeded:
+		return nil
+	case strings.Contains(strings.ToLower(prediction.Error), "nsfw"):
+		return fmt.Errorf("prediction failed: %s: %w", prediction.Error, llm.ErrContentPolicy)
+	default:
+		return fmt.Errorf("prediction failed with status %s: %s", prediction.Status, prediction.Error)
+	}
+}
+
+// outputURLs reads the URLs of the images from the output of the shape the model declares.
+func outputURLs(output json.RawMessage, shape OutputShape) ([]string, error) {
+	var urls []string
+
+	if shape == OutputList {
+		if err := json.Unmarshal(output, &urls); err != nil {
+			return nil, fmt.Errorf("failed to parse prediction output: %w", err)
+		}
+	} else {
+		var url string
+		if err := json.Unmarshal(output, &url); err != nil {
+			return nil, fmt.Errorf("failed to parse prediction output: %w", err)
+		}
+		urls = lo.Compact([]string{url})
+	}
+
+	if len(urls) == 0 {
+		return nil, errors.New("no output returned")
+	}
+
+	return urls, nil
+}
+
+func (c *client) doRequest(req *http.Request, policy llm.RetryPolicy) ([]byte, error) {
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	resp, err := c.hc.Do(req)
+	resp, err := llm.Send(c.hc, req, policy)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(respBody))
-	}
-
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
@@ -137,31 +412,39 @@ func (c *client) pollPrediction(ctx context.Context, predictionID string) (Repli
 			return prediction, errors.New("polling timed out")
 		case <-ticker.C:
 			// Get the prediction status
-			predictionURL := fmt.Sprintf("%s/%s", apiURLPredictions, predictionID)
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, predictionURL, nil)
-			if err != nil {
-				return prediction, fmt.Errorf("failed to create HTTP request: %w", err)
-			}
-
-			respBody, err := c.doRequest(req)
-			if err != nil {
+			var err error
+			if prediction, err = c.getPrediction(ctx, predictionID); err != nil {
 				return prediction, fmt.Errorf("failed to get prediction: %w", err)
 			}
 
-			if err := json.Unmarshal(respBody, &prediction); err != nil {
-				return prediction, fmt.Errorf("failed to parse prediction response: %w", err)
-			}
-
 			// Check if the prediction is complete
-			if prediction.Status == PredictionStatusSucceeded ||
-				prediction.Status == PredictionStatusFailed ||
-				prediction.Status == PredictionStatusCanceled {
+			if isDone(prediction) {
 				return prediction, nil
 			}
 		}
 	}
 }
 
+func (c *client) getPrediction(ctx context.Context, predictionID string) (ReplicatePrediction, error) {
+	predictionURL := fmt.Sprintf("%s%s/%s", c.baseURL, pathPredictions, predictionID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, predictionURL, nil)
+	if err != nil {
+		return ReplicatePrediction{}, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	respBody, err := c.doRequest(req, llm.DefaultRetryPolicy)
+	if err != nil {
+		return ReplicatePrediction{}, err
+	}
+
+	var prediction ReplicatePrediction
+	if err := json.Unmarshal(respBody, &prediction); err != nil {
+		return ReplicatePrediction{}, fmt.Errorf("failed to parse prediction response: %w", err)
+	}
+
+	return prediction, nil
+}
+
 // downloadImage downloads an image from a URL
 func (c *client) downloadImage(ctx context.Context, imageURL string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
@@ -169,16 +452,12 @@ func (c *client) downloadImage(ctx context.Context, imageURL string) ([]byte, er
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	resp, err := c.hc.Do(req)
+	resp, err := llm.Send(c.hc, req, llm.DefaultRetryPolicy)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	imageData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read image data: %w", err)
@@ -0,0 +1,159 @@
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+const pathTestImage = "/files/image.png"
+
+var testModel = ModelSpec{
+	ID:     "test-model",
+	Slug:   "owner/test-model",
+	Inputs: ModelInputs{Prompt: "prompt", AspectRatio: "aspect_ratio"},
+	Output: OutputSingle,
+
+	PricePerImage: 0.01,
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient("test-token", srv.URL, WithHTTPClient(srv.Client()), WithModels(Models{testModel}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	return c
+}
+
+func TestGenerateImage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case pathModels + "/" + testModel.Slug + "/predictions":
+			if got := r.Header.Get("Prefer"); got != "wait" {
+				t.Errorf("Prefer = %q, want wait", got)
+			}
+			_ = json.NewEncoder(w).Encode(ReplicatePrediction{
+				ID:     "p1",
+				Status: PredictionStatusSucceeded,
+				Output: json.RawMessage(`"http://` + r.Host + pathTestImage + `"`),
+			})
+		case pathTestImage:
+			_, _ = w.Write([]byte("png"))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	})
+
+	images, err := c.GenerateImage(context.Background(), "a cat", testModel.ID, domain.ImageSettings{Count: 2})
+	if err != nil {
+		t.Fatalf("GenerateImage: %v", err)
+	}
+	if len(images) != 2 || string(images[0]) != "png" || string(images[1]) != "png" {
+		t.Errorf("images = %q, want the downloaded output of each prediction", images)
+	}
+}
+
+func TestGenerateImageRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int
+	}{
+		{name: "rate limit", status: http.StatusTooManyRequests, wantAttempts: 2},
+		{name: "server error", status: http.StatusInternalServerError, wantAttempts: 1},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+				attempts++
+				if attempts == 1 {
+					http.Error(w, `{"detail":"try again"}`, tt.status)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(ReplicatePrediction{ID: "p1", Status: PredictionStatusSucceeded})
+			})
+
+			_, _ = c.GenerateImage(context.Background(), "a cat", testModel.ID, domain.ImageSettings{})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestSubmitImage(t *testing.T) {
+	var created []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if want := pathModels + "/" + testModel.Slug + "/predictions"; r.URL.Path != want {
+			t.Errorf("path = %s, want %s", r.URL.Path, want)
+		}
+		if got := r.Header.Get("Prefer"); got != "" {
+			t.Errorf("Prefer = %q, submitted predictions must not be waited for", got)
+		}
+
+		var req CreatePredictionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if got := req.Input["aspect_ratio"]; got != "16:9" {
+			t.Errorf("aspect_ratio = %v, want 16:9", got)
+		}
+
+		id := fmt.Sprintf("p%d", len(created)+1)
+		created = append(created, id)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(ReplicatePrediction{ID: id, Status: "starting"})
+	})
+
+	var submitted []string
+	ids, err := c.SubmitImage(context.Background(), nil, "a cat", testModel.ID, domain.ImageSettings{AspectRatio: "16:9", Count: 2}, func(predictionID string) error {
+		if len(submitted) != len(created)-1 {
+			t.Errorf("prediction %s passed on after %d were created", predictionID, len(created))
+		}
+		submitted = append(submitted, predictionID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubmitImage: %v", err)
+	}
+	if !slices.Equal(ids, created) || !slices.Equal(submitted, created) {
+		t.Errorf("ids = %v, submitted = %v, want one prediction per image %v", ids, submitted, created)
+	}
+}
+
+func TestNewClientRejectsModelsWithoutPrice(t *testing.T) {
+	unpriced := testModel
+	unpriced.PricePerImage = 0
+
+	if _, err := NewClient("test-token", "", WithModels(Models{unpriced})); err == nil {
+		t.Error("NewClient accepted a model without a price per image")
+	}
+}
+
+func TestListModelsReportsPricePerImage(t *testing.T) {
+	c := newTestClient(t, http.NotFound)
+
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 1 || models[0].Price.PerImage != testModel.PricePerImage {
+		t.Errorf("models = %+v, want %s priced %v per image", models, testModel.ID, testModel.PricePerImage)
+	}
+}
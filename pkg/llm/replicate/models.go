@@ -3,11 +3,24 @@ package replicate
 import "github.com/dskvich/ai-bot/pkg/domain"
 
 const (
-	FluxProUltra11Model = "black-forest-labs/flux-1.1-pro-ultra"
+	// Real-ESRGAN is a community model, so it is run by version
+	RealESRGANVersion = "42fed1c4974146d4d2414e2be2c5277c7fcf05fcc3a73abf41610695738c1d7b"
+	UpscaleFactor     = 2
 )
 
-var ModelToReplicateModel = map[string]string{
-	domain.FluxProUltra11: FluxProUltra11Model,
-}
+const (
+	DefaultAspectRatio    = "3:2"
+	MatchInputAspectRatio = "match_input_image" // Keeps the proportions of the edited image
+
+	OutputFormatJPG = "jpg"
+	OutputFormatPNG = "png"
 
-const DefaultAspectRatio = "3:2"
+	maxSeed = 1 << 31
+)
+
+// imageSides are the longer sides of the images per size, for models taking width and height.
+var imageSides = map[string]int{
+	domain.ImageSizeSmall:  512,
+	domain.ImageSizeMedium: 768,
+	domain.ImageSizeLarge:  1024,
+}
@@ -0,0 +1,202 @@
+package replicate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/samber/lo"
+)
+
+// OutputShape tells how a model returns its images.
+type OutputShape string
+
+const (
+	OutputSingle OutputShape = "single" // A URL
+	OutputList   OutputShape = "list"   // A list of URLs
+)
+
+// ModelInputs names the inputs a model takes. An empty name means the model lacks the input.
+type ModelInputs struct {
+	Prompt         string `json:"prompt"`
+	Image          string `json:"image,omitempty"` // The image to redraw, for models that edit images
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	Width          string `json:"width,omitempty"`
+	Height         string `json:"height,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Steps          string `json:"steps,omitempty"`
+	Guidance       string `json:"guidance,omitempty"`
+	Seed           string `json:"seed,omitempty"`
+	OutputFormat   string `json:"output_format,omitempty"`
+	NumOutputs     string `json:"num_outputs,omitempty"` // Draws several images in a single prediction
+}
+
+// ModelSpec describes how to run a Replicate model:
+//
+//	{"id":"sdxl","name":"SDXL","slug":"stability-ai/sdxl","version":"7762fd07...",
+//	 "inputs":{"prompt":"prompt","width":"width","height":"height","negative_prompt":"negative_prompt",
+//	 "steps":"num_inference_steps","guidance":"guidance_scale","seed":"seed","num_outputs":"num_outputs"},
+//	 "output":"list","negative_prompt":"blurry, low quality","guidance":7.5,"steps":{"standard":25,"hd":50},
+//	 "price_per_image":0.0045}
+type ModelSpec struct {
+	ID      string      `json:"id"` // Model ID offered to users
+	Name    string      `json:"name,omitempty"`
+	Slug    string      `json:"slug"`              // Owner and name of the model on Replicate
+	Version string      `json:"version,omitempty"` // Community models are run by version only
+	Inputs  ModelInputs `json:"inputs"`
+	Output  OutputShape `json:"output,omitempty"` // Single by default
+
+	PricePerImage float64 `json:"price_per_image"` // USD, what usage of the model costs users
+
+	// Values of the inputs the user doesn't choose
+	NegativePrompt        string         `json:"negative_prompt,omitempty"`
+	Guidance              float64        `json:"guidance,omitempty"`
+	Steps                 map[string]int `json:"steps,omitempty"`                    // Per image quality, e.g. {"standard":25,"hd":50}
+	MatchInputAspectRatio bool           `json:"match_input_aspect_ratio,omitempty"` // Keeps the proportions of edited images unless the user chose others
+}
+
+// Models is a list of model specs, as a JSON array in the configuration.
+type Models []ModelSpec
+
+func (m *Models) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]ModelSpec)(m))
+}
+
+// DefaultModels are offered without any configuration.
+var DefaultModels = Models{
+	{
+		ID:   domain.FluxProUltra11,
+		Slug: "black-forest-labs/flux-1.1-pro-ultra",
+		Inputs: ModelInputs{
+			Prompt:       "prompt",
+			AspectRatio:  "aspect_ratio",
+			Seed:         "seed",
+			OutputFormat: "output_format",
+		},
+		Output:        OutputSingle,
+		PricePerImage: 0.06,
+	},
+	{
+		ID:   domain.FluxKontextPro,
+		Slug: "black-forest-labs/flux-kontext-pro",
+		Inputs: ModelInputs{
+			Prompt:       "prompt",
+			Image:        "input_image",
+			AspectRatio:  "aspect_ratio",
+			Seed:         "seed",
+			OutputFormat: "output_format",
+		},
+		Output:                OutputSingle,
+		MatchInputAspectRatio: true,
+		PricePerImage:         0.04,
+	},
+}
+
+// realESRGAN upscales images, it is not offered to draw them.
+var realESRGAN = ModelSpec{
+	ID:      domain.RealESRGANModel,
+	Slug:    "nightmareai/real-esrgan",
+	Version: RealESRGANVersion,
+	Inputs:  ModelInputs{Image: "image"},
+	Output:  OutputSingle,
+
+	PricePerImage: 0.002,
+}
+
+// Merge returns the models along with the other ones. Other models replace the
+// models with the same ID in place.
+func (m Models) Merge(other Models) Models {
+	result := slices.Clone(m)
+	for _, spec := range other {
+		if i := slices.IndexFunc(result, func(s ModelSpec) bool { return s.ID == spec.ID }); i >= 0 {
+			result[i] = spec
+		} else {
+			result = append(result, spec)
+		}
+	}
+	return result
+}
+
+func (s ModelSpec) validate() error {
+	switch {
+	case s.ID == "":
+		return errors.New("model id cannot be empty")
+	case s.Slug == "":
+		return fmt.Errorf("model %s: slug cannot be empty", s.ID)
+	case s.Inputs.Prompt == "":
+		return fmt.Errorf("model %s: prompt input cannot be empty", s.ID)
+	case !slices.Contains([]OutputShape{"", OutputSingle, OutputList}, s.Output):
+		return fmt.Errorf("model %s: unknown output shape %s", s.ID, s.Output)
+	case s.Inputs.NumOutputs != "" && s.Output != OutputList:
+		return fmt.Errorf("model %s: several outputs need the list output shape", s.ID)
+	case s.PricePerImage <= 0:
+		return fmt.Errorf("model %s: price per image must be positive", s.ID)
+	}
+	return nil
+}
+
+// input maps the prompt, the image to redraw if any and the settings onto the inputs
+// the model declares. Settings the model has no inputs for are left out.
+func (s ModelSpec) input(prompt string, image []byte, settings domain.ImageSettings, count int) map[string]interface{} {
+	input := map[string]interface{}{}
+	set := func(name string, value interface{}) {
+		if name != "" {
+			input[name] = value
+		}
+	}
+
+	set(s.Inputs.Prompt, prompt)
+	if image != nil {
+		set(s.Inputs.Image, dataURL(image))
+	}
+
+	aspectRatio := lo.CoalesceOrEmpty(settings.AspectRatio, DefaultAspectRatio)
+	if image != nil && settings.AspectRatio == "" && s.MatchInputAspectRatio {
+		aspectRatio = MatchInputAspectRatio
+	}
+	set(s.Inputs.AspectRatio, aspectRatio)
+
+	width, height := imageDimensions(settings)
+	set(s.Inputs.Width, width)
+	set(s.Inputs.Height, height)
+
+	set(s.Inputs.OutputFormat, outputFormat(settings))
+
+	if s.NegativePrompt != "" {
+		set(s.Inputs.NegativePrompt, s.NegativePrompt)
+	}
+	if s.Guidance != 0 {
+		set(s.Inputs.Guidance, s.Guidance)
+	}
+	if steps := s.Steps[lo.CoalesceOrEmpty(settings.Quality, domain.ImageQualityStandard)]; steps != 0 {
+		set(s.Inputs.Steps, steps)
+	}
+
+	// A seed of its own keeps the images drawn at once apart
+	set(s.Inputs.Seed, rand.IntN(maxSeed))
+
+	if count > 1 {
+		set(s.Inputs.NumOutputs, count)
+	}
+
+	return input
+}
+
+// imageDimensions fits the aspect ratio of the settings into a square of their size,
+// in multiples of 8 as diffusion models expect.
+func imageDimensions(settings domain.ImageSettings) (int, int) {
+	side := lo.ValueOr(imageSides, settings.Size, imageSides[domain.ImageSizeLarge])
+
+	w, h, ok := settings.Ratio()
+	switch {
+	case !ok:
+		return side, side
+	case w > h:
+		return side, side * h / w / 8 * 8
+	default:
+		return side * w / h / 8 * 8, side
+	}
+}
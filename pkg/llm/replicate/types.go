@@ -1,6 +1,9 @@
 package replicate
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type ReplicatePrediction struct {
 	ID          string                 `json:"id"`
@@ -13,17 +16,15 @@ type ReplicatePrediction struct {
 	URLs        map[string]string      `json:"urls"`
 	Metrics     map[string]interface{} `json:"metrics"`
 	Input       map[string]interface{} `json:"input"`
-	Output      string                 `json:"output"`
+	Output      json.RawMessage        `json:"output"` // Shaped as the model declares
 	StartedAt   time.Time              `json:"started_at,omitempty"`
 }
 
 type CreatePredictionRequest struct {
-	Input map[string]interface{} `json:"input"`
-}
-
-type FluxInput struct {
-	Prompt      string `json:"prompt"`
-	AspectRatio string `json:"aspect_ratio"`
+	Version             string                 `json:"version,omitempty"`
+	Input               map[string]interface{} `json:"input"`
+	Webhook             string                 `json:"webhook,omitempty"`
+	WebhookEventsFilter []string               `json:"webhook_events_filter,omitempty"`
 }
 
 const (
@@ -33,3 +34,6 @@ const (
 	PredictionStatusFailed     = "failed"
 	PredictionStatusCanceled   = "canceled"
 )
+
+// WebhookEventCompleted makes Replicate post the prediction once it succeeds, fails or is canceled.
+const WebhookEventCompleted = "completed"
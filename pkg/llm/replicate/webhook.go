@@ -0,0 +1,64 @@
+package replicate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/llm"
+)
+
+// webhookTolerance limits how old a posted webhook may be, so that it can't be replayed.
+const webhookTolerance = 5 * time.Minute
+
+// SignWebhook returns the signature Replicate signs a webhook with, given the
+// signing secret in its "whsec_..." form.
+// https://replicate.com/docs/topics/webhooks/verify-webhook
+func SignWebhook(secret, id, timestamp string, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "." + string(body)))
+
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyWebhook checks that the webhook was posted by Replicate recently. The signature
+// header may hold several space-separated signatures, one of them has to match.
+// Without a secret no webhook is trusted, as anyone could sign it.
+func VerifyWebhook(secret string, header http.Header, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("%w: no signing secret configured", llm.ErrInvalidWebhook)
+	}
+
+	id, timestamp := header.Get("webhook-id"), header.Get("webhook-timestamp")
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", llm.ErrInvalidWebhook, timestamp)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return fmt.Errorf("%w: timestamp is %s off", llm.ErrInvalidWebhook, age)
+	}
+
+	expected, err := SignWebhook(secret, id, timestamp, body)
+	if err != nil {
+		return err
+	}
+
+	for _, signature := range strings.Fields(header.Get("webhook-signature")) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: signature mismatch", llm.ErrInvalidWebhook)
+}
@@ -0,0 +1,44 @@
+package replicate
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/llm"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := "whsec_" + base64.StdEncoding.EncodeToString([]byte("test webhook secret"))
+	body := []byte(`{"id":"p1","status":"succeeded"}`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signature, err := SignWebhook(secret, "p1", timestamp, body)
+	if err != nil {
+		t.Fatalf("SignWebhook: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("webhook-id", "p1")
+	header.Set("webhook-timestamp", timestamp)
+	header.Set("webhook-signature", "v1,c29tZXRoaW5nIGVsc2U= "+signature)
+
+	if err := VerifyWebhook(secret, header, body, now); err != nil {
+		t.Errorf("VerifyWebhook: %v", err)
+	}
+
+	// Anyone can sign with an empty key, so nothing is trusted without a secret
+	unsigned, err := SignWebhook("", "p1", timestamp, body)
+	if err != nil {
+		t.Fatalf("SignWebhook: %v", err)
+	}
+	header.Set("webhook-signature", unsigned)
+
+	if err := VerifyWebhook("", header, body, now); !errors.Is(err, llm.ErrInvalidWebhook) {
+		t.Errorf("err = %v, want %v", err, llm.ErrInvalidWebhook)
+	}
+}
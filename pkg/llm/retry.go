@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// Errors providers respond with that the user can act upon.
+var (
+	ErrRateLimited   = errors.New("rate limited by provider")
+	ErrQuotaExceeded = errors.New("provider quota exceeded")
+	ErrContentPolicy = errors.New("rejected by provider content policy")
+)
+
+// APIError is a non-2xx response of a provider API.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Zero if the provider did not ask to wait
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, response: %s", e.StatusCode, e.Body)
+}
+
+// Unwrap exposes the kind of the error, so that errors.Is(err, ErrRateLimited) works.
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Retryable reports whether the same request may succeed later.
+func (e *APIError) Retryable() bool {
+	if errors.Is(e.kind, ErrQuotaExceeded) {
+		return false
+	}
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// NewAPIError builds the error for an unsuccessful response and recognizes its kind
+// from the status code and the error codes providers put into the body.
+func NewAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	lowerBody := strings.ToLower(apiErr.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusPaymentRequired,
+		strings.Contains(lowerBody, "insufficient_quota"),
+		strings.Contains(lowerBody, "billing_hard_limit_reached"),
+		strings.Contains(lowerBody, "credit balance is too low"):
+		apiErr.kind = ErrQuotaExceeded
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.kind = ErrRateLimited
+	case strings.Contains(lowerBody, "content_policy_violation"),
+		strings.Contains(lowerBody, "safety system"):
+		apiErr.kind = ErrContentPolicy
+	}
+
+	return apiErr
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+
+	return 0
+}
+
+// RetryPolicy defines how transient provider failures are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration // Delay before the first retry, doubled for every next one
+	MaxDelay    time.Duration
+	Deadline    time.Duration // Time after which no more attempts are made
+	UnsentOnly  bool          // Retry only failures the provider surely didn't act upon
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+	Deadline:    90 * time.Second,
+}
+
+// CreateRetryPolicy is for requests that must not run twice, such as creating a
+// billed prediction. Only rate limits and failed connections are retried, as a timeout
+// or a server error leaves unknown whether the provider has already started the work.
+var CreateRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+	Deadline:    90 * time.Second,
+	UnsentOnly:  true,
+}
+
+// NoRetryPolicy is for requests that have a cheaper way out than waiting, such as
+// classifying a message, which keywords can do instead.
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// ResponseTimeout limits how long a provider may take to start responding. Reading
+// the response isn't limited, as completions are streamed for minutes.
+const ResponseTimeout = 3 * time.Minute
+
+// NewHTTPClient creates the client provider APIs are called with, which gives up on
+// requests the provider doesn't answer within ResponseTimeout.
+func NewHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = ResponseTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+// Send performs the request and returns the response when its status is 2xx.
+// Rate limits, server errors, timeouts and failed connections are retried with jittered exponential
+// backoff, or after the delay the provider asks for in Retry-After. Other failures,
+// and the last one once the attempts or the deadline run out, are returned as is;
+// unsuccessful responses as *APIError. The caller is responsible for closing the response body.
+func Send(hc *http.Client, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	ctx := req.Context()
+	deadline := time.Now().Add(policy.Deadline)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := sendOnce(hc, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		retryAfter, retryable := policy.retryDelay(err)
+		if !retryable || attempt >= policy.MaxAttempts || !rewindBody(req) {
+			return nil, err
+		}
+
+		delay := max(policy.backoff(attempt), retryAfter)
+		if time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+
+		slog.WarnContext(ctx, "Retrying provider request", "url", req.URL.Redacted(), "attempt", attempt, "delay", delay, logger.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func sendOnce(hc *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, NewAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// retryDelay reports whether the error is transient and how long the provider asked to wait.
+func (p RetryPolicy) retryDelay(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if p.UnsentOnly {
+			return apiErr.RetryAfter, errors.Is(apiErr, ErrRateLimited)
+		}
+		return apiErr.RetryAfter, apiErr.Retryable()
+	}
+
+	// The request never left when the connection couldn't be made
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return 0, true
+	}
+
+	if p.UnsentOnly {
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// rewindBody prepares the request to be sent again and reports whether it can be.
+func rewindBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+
+	if req.GetBody == nil {
+		return false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+
+	req.Body = body
+
+	return true
+}
+
+// backoff returns the jittered delay before the retry following the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+const (
+	summaryKeepTurns = 2 // Latest user turns kept verbatim when compacting
+
+	summarizerPrompt = `You maintain a running summary of a conversation between a user and an AI assistant.
+Merge the previous summary with the new messages into one updated summary.
+Keep facts, names, numbers, decisions, user preferences and open questions; drop small talk.
+Write in the language of the conversation, as a compact list, under 300 words.
+Reply with the summary only.`
+)
+
+// HistorySummarizer compresses old turns into a running summary stored on the
+// chat instead of dropping them. A cheap model is used to write the summary.
+type HistorySummarizer struct {
+	generator TextGenerator
+	model     string
+	maxTokens int
+	trimmer   *HistoryTrimmer
+}
+
+// NewHistorySummarizer creates a summarizer that compacts the history once it
+// grows past maxTokens. Summaries are written by the model through generator.
+func NewHistorySummarizer(generator TextGenerator, model string, maxTokens int) *HistorySummarizer {
+	return &HistorySummarizer{
+		generator: generator,
+		model:     model,
+		maxTokens: maxTokens,
+		trimmer:   NewHistoryTrimmer(),
+	}
+}
+
+// Expire folds the whole history into the summary once the chat TTL has passed.
+// The history is dropped without a summary if the summary model fails.
+func (s *HistorySummarizer) Expire(ctx context.Context, chat *domain.Chat) {
+	if len(chat.Messages) == 0 {
+		return
+	}
+
+	summary, err := s.summarize(ctx, chat.Summary, chat.Messages)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to summarize expired history", logger.Err(err))
+		s.trimmer.Expire(ctx, chat)
+		return
+	}
+
+	chat.Summary = summary
+	chat.Messages = nil
+}
+
+// Fit summarizes all but the latest turns when the history is too long, then
+// trims whatever still does not fit into the context window.
+func (s *HistorySummarizer) Fit(ctx context.Context, chat *domain.Chat) bool {
+	counter := TokenCounterFor(chat.TextModel)
+
+	if countMessages(counter, chat.Messages) > s.maxTokens {
+		if cut := summaryCutIndex(chat.Messages); cut > 0 {
+			summary, err := s.summarize(ctx, chat.Summary, chat.Messages[:cut])
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to summarize history", logger.Err(err))
+			} else {
+				slog.InfoContext(ctx, "History summarized", "messagesCount", cut)
+				chat.Summary = summary
+				chat.Messages = chat.Messages[cut:]
+			}
+		}
+	}
+
+	return s.trimmer.Fit(ctx, chat)
+}
+
+func (s *HistorySummarizer) summarize(ctx context.Context, previous string, msgs []domain.Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Previous summary:\n" + previous + "\n\nNew messages:\n")
+	}
+	for _, msg := range msgs {
+		writeTranscriptLine(&transcript, msg)
+	}
+
+	resp, err := s.generator.CreateChatCompletion(ctx, &domain.Chat{
+		TextModel:    s.model,
+		SystemPrompt: summarizerPrompt,
+		Messages: []domain.Message{{
+			Role:         domain.MessageRoleUser,
+			ContentParts: []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: transcript.String()}},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("generating summary: %w", err)
+	}
+
+	for _, part := range resp.ContentParts {
+		if part.Type == domain.ContentPartTypeText && strings.TrimSpace(part.Data) != "" {
+			return strings.TrimSpace(part.Data), nil
+		}
+	}
+
+	return "", errors.New("empty summary returned")
+}
+
+func writeTranscriptLine(w *strings.Builder, msg domain.Message) {
+	switch {
+	case msg.Role == domain.MessageRoleTool:
+		w.WriteString("Tool result: ")
+	case msg.Role == domain.MessageRoleUser:
+		w.WriteString("User: ")
+	default:
+		w.WriteString("Assistant: ")
+	}
+
+	for _, part := range msg.ContentParts {
+		if part.Type == domain.ContentPartTypeImage {
+			w.WriteString(omittedImageText + " ")
+			continue
+		}
+		w.WriteString(part.Data + " ")
+	}
+
+	for _, call := range msg.ToolCalls {
+		fmt.Fprintf(w, "[called %s(%s)] ", call.Name, call.Arguments)
+	}
+
+	w.WriteString("\n")
+}
+
+// summaryCutIndex returns the index of the first message kept verbatim,
+// which starts one of the latest user turns.
+func summaryCutIndex(msgs []domain.Message) int {
+	turns := 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == domain.MessageRoleUser {
+			turns++
+			if turns == summaryKeepTurns {
+				return i
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+// TextGenerator answers the chat history. Providers that run tools append the
+// intermediate tool call and tool result messages to chat.Messages and return the final answer.
+type TextGenerator interface {
+	CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error)
+}
+
+// TextStreamer is implemented by text generators that can deliver a completion incrementally.
+type TextStreamer interface {
+	CreateChatCompletionStream(ctx context.Context, chat *domain.Chat, onDelta func(delta string)) (*domain.Message, error)
+}
+
+// TextRoutes finds the provider serving a text model.
+type TextRoutes interface {
+	TextGenerator(model string) (TextGenerator, bool)
+}
+
+type MultiProviderTextClient struct {
+	providers TextRoutes
+	fallbacks FallbackChains
+}
+
+func NewMultiProviderTextClient(providers TextRoutes, fallbacks FallbackChains) *MultiProviderTextClient {
+	return &MultiProviderTextClient{
+		providers: providers,
+		fallbacks: fallbacks,
+	}
+}
+
+// CreateChatCompletion answers with the chat model, or with its fallbacks if it fails.
+// The Model of the returned message names the model that actually answered.
+func (c *MultiProviderTextClient) CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error) {
+	complete := func(provider TextGenerator, attempt *domain.Chat) (*domain.Message, error) {
+		return provider.CreateChatCompletion(ctx, attempt)
+	}
+
+	return c.withFallbacks(ctx, chat, complete, func() bool { return true })
+}
+
+// CreateChatCompletionStream streams the completion when the provider supports it.
+// Otherwise the whole answer is passed to onDelta at once. Fallback models are
+// only tried until the first piece of the answer has been delivered.
+func (c *MultiProviderTextClient) CreateChatCompletionStream(
+	ctx context.Context,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	delivered := false
+
+	complete := func(provider TextGenerator, attempt *domain.Chat) (*domain.Message, error) {
+		return c.stream(ctx, provider, attempt, func(delta string) {
+			delivered = true
+			onDelta(delta)
+		})
+	}
+
+	return c.withFallbacks(ctx, chat, complete, func() bool { return !delivered })
+}
+
+// withFallbacks runs the completion with the chat model and then its fallbacks until one
+// succeeds or canFallBack forbids going on. Each model gets its own copy of the chat,
+// whose messages replace the original ones on success.
+func (c *MultiProviderTextClient) withFallbacks(
+	ctx context.Context,
+	chat *domain.Chat,
+	complete func(provider TextGenerator, attempt *domain.Chat) (*domain.Message, error),
+	canFallBack func() bool,
+) (*domain.Message, error) {
+	var err error
+
+	for _, model := range c.fallbacks.candidates(chat.TextModel) {
+		provider, ok := c.providers.TextGenerator(model)
+		if !ok {
+			err = fmt.Errorf("no provider found for model: %s", model)
+			continue
+		}
+
+		attempt := *chat
+		attempt.TextModel = model
+		attempt.Messages = slices.Clone(chat.Messages)
+
+		var msg *domain.Message
+		if msg, err = complete(provider, &attempt); err == nil {
+			chat.Messages = attempt.Messages
+			msg.Model = model
+			return msg, nil
+		}
+
+		if !canFallBack() || !shouldFallBack(ctx, model, err) {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+func (c *MultiProviderTextClient) stream(
+	ctx context.Context,
+	provider TextGenerator,
+	chat *domain.Chat,
+	onDelta func(delta string),
+) (*domain.Message, error) {
+	if streamer, ok := provider.(TextStreamer); ok {
+		return streamer.CreateChatCompletionStream(ctx, chat, onDelta)
+	}
+
+	msg, err := provider.CreateChatCompletion(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, part := range msg.ContentParts {
+		if part.Type == domain.ContentPartTypeText {
+			onDelta(part.Data)
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+// TokenCounter estimates token counts without a provider tokenizer. The ratios are
+// tuned per model family and err on the high side so the budget is not exceeded.
+type TokenCounter struct {
+	asciiCharsPerToken    float64 // English text and code
+	nonASCIICharsPerToken float64 // Cyrillic and other scripts take more tokens
+	imageTokens           int
+	messageOverhead       int
+}
+
+// TokenCounterFor returns the token counter matching the model family.
+func TokenCounterFor(model string) TokenCounter {
+	switch {
+	case strings.HasPrefix(model, "claude"):
+		return TokenCounter{asciiCharsPerToken: 3.5, nonASCIICharsPerToken: 1.5, imageTokens: 1600, messageOverhead: 4}
+	case strings.HasPrefix(model, "gemini"):
+		return TokenCounter{asciiCharsPerToken: 4, nonASCIICharsPerToken: 2, imageTokens: 258, messageOverhead: 4}
+	default:
+		return TokenCounter{asciiCharsPerToken: 4, nonASCIICharsPerToken: 2, imageTokens: 1105, messageOverhead: 4}
+	}
+}
+
+func (c TokenCounter) CountText(text string) int {
+	var ascii, nonASCII int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			nonASCII++
+		}
+	}
+	return int(float64(ascii)/c.asciiCharsPerToken+float64(nonASCII)/c.nonASCIICharsPerToken) + 1
+}
+
+func (c TokenCounter) CountMessage(msg domain.Message) int {
+	tokens := c.messageOverhead
+	for _, part := range msg.ContentParts {
+		switch part.Type {
+		case domain.ContentPartTypeImage:
+			tokens += c.imageTokens
+		default:
+			tokens += c.CountText(part.Data)
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		tokens += c.CountText(call.Name) + c.CountText(call.Arguments)
+	}
+	return tokens
+}
@@ -0,0 +1,270 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type calculator struct{}
+
+func (c *calculator) Definition() Definition {
+	return Definition{
+		Name: "calculate",
+		Description: "Evaluates an arithmetic expression. Supports + - * / % ^, parentheses, " +
+			"the functions sqrt, abs, round, floor, ceil, ln, log10 and the constants pi and e.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"expression": {
+					"type": "string",
+					"description": "Expression to evaluate, e.g. (2 + 3) * 4 ^ 2"
+				}
+			},
+			"required": ["expression"]
+		}`),
+	}
+}
+
+func (c *calculator) Call(_ context.Context, arguments string) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("parsing arguments: %w", err)
+	}
+
+	p := &exprParser{input: args.Expression}
+
+	result, err := p.parse()
+	if err != nil {
+		return "", err
+	}
+
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return "", errors.New("result is not a finite number")
+	}
+
+	return strconv.FormatFloat(result, 'g', -1, 64), nil
+}
+
+// exprParser is a recursive descent parser for arithmetic expressions:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/" | "%") factor }
+//	factor = unary [ "^" factor ]
+//	unary  = ("+" | "-") unary | primary
+//	primary = number | constant | func "(" expr ")" | "(" expr ")"
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func (p *exprParser) parse() (float64, error) {
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) expr() (float64, error) {
+	left, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		switch p.peek() {
+		case '+':
+			p.pos++
+			right, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			left += right
+		case '-':
+			p.pos++
+			right, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			left -= right
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *exprParser) term() (float64, error) {
+	left, err := p.factor()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.factor()
+		if err != nil {
+			return 0, err
+		}
+
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, errors.New("division by zero")
+			}
+			left /= right
+		case '%':
+			if right == 0 {
+				return 0, errors.New("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+func (p *exprParser) factor() (float64, error) {
+	base, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+
+	exp, err := p.factor() // Right associative
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Pow(base, exp), nil
+}
+
+func (p *exprParser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.unary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.unary()
+	default:
+		return p.primary()
+	}
+}
+
+func (p *exprParser) primary() (float64, error) {
+	ch := p.peek()
+
+	switch {
+	case ch == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return v, nil
+	case ch == '.' || unicode.IsDigit(rune(ch)):
+		return p.number()
+	case unicode.IsLetter(rune(ch)):
+		return p.identifier()
+	case ch == 0:
+		return 0, errors.New("unexpected end of expression")
+	default:
+		return 0, fmt.Errorf("unexpected %q at position %d", ch, p.pos)
+	}
+}
+
+func (p *exprParser) number() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+
+	v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) identifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+
+	switch name {
+	case "pi":
+		return math.Pi, nil
+	case "e":
+		return math.E, nil
+	}
+
+	fn, ok := map[string]func(float64) float64{
+		"sqrt":  math.Sqrt,
+		"abs":   math.Abs,
+		"round": math.Round,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"ln":    math.Log,
+		"log10": math.Log10,
+	}[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown identifier %q", name)
+	}
+
+	if p.peek() != '(' {
+		return 0, fmt.Errorf("expected ( after %s", name)
+	}
+
+	arg, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+
+	return fn(arg), nil
+}
+
+// peek skips whitespace and returns the next character, or 0 at the end of input.
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	_ "time/tzdata" // The runtime image ships without a zoneinfo database
+)
+
+type currentTime struct{}
+
+func (t *currentTime) Definition() Definition {
+	return Definition{
+		Name:        "current_datetime",
+		Description: "Returns the current date, time and weekday in the given time zone.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"timezone": {
+					"type": "string",
+					"description": "IANA time zone name, e.g. Europe/Moscow. Defaults to UTC."
+				}
+			}
+		}`),
+	}
+}
+
+func (t *currentTime) Call(_ context.Context, arguments string) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("parsing arguments: %w", err)
+	}
+
+	loc := time.UTC
+	if args.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(args.Timezone); err != nil {
+			return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+		}
+	}
+
+	now := time.Now().In(loc)
+
+	return fmt.Sprintf("%s (%s, %s)", now.Format(time.RFC3339), now.Weekday(), loc), nil
+}
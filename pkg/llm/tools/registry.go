@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// Tool is a Go function the model can call during a chat completion.
+type Tool interface {
+	Definition() Definition
+	Call(ctx context.Context, arguments string) (string, error)
+}
+
+// Definition describes a tool to the model. Parameters is a JSON schema of the arguments object.
+type Definition struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+type Registry struct {
+	tools []Tool
+	index map[string]Tool
+}
+
+func NewRegistry(tools ...Tool) *Registry {
+	index := make(map[string]Tool, len(tools))
+	for _, tool := range tools {
+		index[tool.Definition().Name] = tool
+	}
+
+	return &Registry{
+		tools: tools,
+		index: index,
+	}
+}
+
+// Builtin returns a registry with the tools shipped with the bot.
+func Builtin() *Registry {
+	return NewRegistry(
+		&currentTime{},
+		&calculator{},
+		&unitConverter{},
+	)
+}
+
+func (r *Registry) Definitions() []Definition {
+	defs := make([]Definition, 0, len(r.tools))
+	for _, tool := range r.tools {
+		defs = append(defs, tool.Definition())
+	}
+	return defs
+}
+
+// Call runs the named tool. Failures are returned as text so the model can
+// see what went wrong and answer accordingly.
+func (r *Registry) Call(ctx context.Context, name, arguments string) string {
+	tool, ok := r.index[name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", name)
+	}
+
+	slog.InfoContext(ctx, "Calling tool", "name", name, "arguments", arguments)
+
+	result, err := tool.Call(ctx, arguments)
+	if err != nil {
+		slog.WarnContext(ctx, "Tool call failed", "name", name, logger.Err(err))
+		return "error: " + err.Error()
+	}
+
+	return result
+}
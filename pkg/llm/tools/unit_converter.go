@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type unitConverter struct{}
+
+// unit is a measurement unit with its factor relative to the base unit of its dimension.
+type unit struct {
+	dimension string
+	factor    float64
+}
+
+const dimensionTemperature = "temperature"
+
+// units maps unit symbols to their dimension and factor.
+var units = map[string]unit{
+	// Length, meters
+	"mm": {"length", 0.001}, "cm": {"length", 0.01}, "m": {"length", 1}, "km": {"length", 1000},
+	"in": {"length", 0.0254}, "ft": {"length", 0.3048}, "yd": {"length", 0.9144},
+	"mi": {"length", 1609.344}, "nmi": {"length", 1852},
+
+	// Mass, kilograms
+	"mg": {"mass", 1e-6}, "g": {"mass", 0.001}, "kg": {"mass", 1}, "t": {"mass", 1000},
+	"oz": {"mass", 0.028349523125}, "lb": {"mass", 0.45359237}, "st": {"mass", 6.35029318},
+
+	// Volume, liters
+	"ml": {"volume", 0.001}, "l": {"volume", 1}, "m3": {"volume", 1000},
+	"tsp": {"volume", 0.00492892159375}, "tbsp": {"volume", 0.01478676478125},
+	"floz": {"volume", 0.0295735295625}, "cup": {"volume", 0.2365882365},
+	"pt": {"volume", 0.473176473}, "qt": {"volume", 0.946352946}, "gal": {"volume", 3.785411784},
+
+	// Area, square meters
+	"cm2": {"area", 0.0001}, "m2": {"area", 1}, "km2": {"area", 1e6}, "ha": {"area", 10000},
+	"ft2": {"area", 0.09290304}, "acre": {"area", 4046.8564224},
+
+	// Speed, meters per second
+	"m/s": {"speed", 1}, "km/h": {"speed", 1 / 3.6}, "mph": {"speed", 0.44704}, "kn": {"speed", 1852.0 / 3600},
+
+	// Time, seconds
+	"ms": {"time", 0.001}, "s": {"time", 1}, "min": {"time", 60}, "h": {"time", 3600},
+	"d": {"time", 86400}, "wk": {"time", 604800},
+
+	// Digital storage, bytes
+	"b": {"data", 1}, "kb": {"data", 1e3}, "mb": {"data", 1e6}, "gb": {"data", 1e9}, "tb": {"data", 1e12},
+	"kib": {"data", 1 << 10}, "mib": {"data", 1 << 20}, "gib": {"data", 1 << 30}, "tib": {"data", 1 << 40},
+
+	// Temperature is converted separately
+	"c": {dimensionTemperature, 0}, "f": {dimensionTemperature, 0}, "k": {dimensionTemperature, 0},
+}
+
+func (u *unitConverter) Definition() Definition {
+	return Definition{
+		Name: "convert_units",
+		Description: "Converts a value between units of length (mm, cm, m, km, in, ft, yd, mi, nmi), " +
+			"mass (mg, g, kg, t, oz, lb, st), volume (ml, l, m3, tsp, tbsp, floz, cup, pt, qt, gal), " +
+			"area (cm2, m2, km2, ha, ft2, acre), speed (m/s, km/h, mph, kn), time (ms, s, min, h, d, wk), " +
+			"data (b, kb, mb, gb, tb, kib, mib, gib, tib) and temperature (c, f, k). US customary volumes are used.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"value": {"type": "number"},
+				"from": {"type": "string", "description": "Source unit symbol"},
+				"to": {"type": "string", "description": "Target unit symbol"}
+			},
+			"required": ["value", "from", "to"]
+		}`),
+	}
+}
+
+func (u *unitConverter) Call(_ context.Context, arguments string) (string, error) {
+	var args struct {
+		Value float64 `json:"value"`
+		From  string  `json:"from"`
+		To    string  `json:"to"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("parsing arguments: %w", err)
+	}
+
+	fromKey, toKey := normalizeUnit(args.From), normalizeUnit(args.To)
+
+	from, ok := units[fromKey]
+	if !ok {
+		return "", fmt.Errorf("unknown unit %q", args.From)
+	}
+	to, ok := units[toKey]
+	if !ok {
+		return "", fmt.Errorf("unknown unit %q", args.To)
+	}
+
+	if from.dimension != to.dimension {
+		return "", fmt.Errorf("cannot convert %s to %s", from.dimension, to.dimension)
+	}
+
+	var result float64
+	if from.dimension == dimensionTemperature {
+		result = fromKelvin(toKelvin(args.Value, fromKey), toKey)
+	} else {
+		result = args.Value * from.factor / to.factor
+	}
+
+	return fmt.Sprintf("%s %s", strconv.FormatFloat(result, 'g', 10, 64), args.To), nil
+}
+
+func normalizeUnit(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "°")
+	return strings.NewReplacer("²", "2", "³", "3").Replace(s)
+}
+
+func toKelvin(v float64, scale string) float64 {
+	switch scale {
+	case "c":
+		return v + 273.15
+	case "f":
+		return (v-32)*5/9 + 273.15
+	default:
+		return v
+	}
+}
+
+func fromKelvin(v float64, scale string) float64 {
+	switch scale {
+	case "c":
+		return v - 273.15
+	case "f":
+		return (v-273.15)*9/5 + 32
+	default:
+		return v
+	}
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+type usageCollectorKey struct{}
+
+// UsageCollector gathers the usage reported by provider clients while an update is handled.
+type UsageCollector struct {
+	mu     sync.Mutex
+	usages []domain.Usage
+	parent *UsageCollector
+}
+
+// ContextWithUsageCollector returns a context collecting usage. Usage reported within
+// a nested collector's context is collected by the enclosing collectors as well.
+func ContextWithUsageCollector(ctx context.Context) (context.Context, *UsageCollector) {
+	parent, _ := ctx.Value(usageCollectorKey{}).(*UsageCollector)
+	collector := &UsageCollector{parent: parent}
+	return context.WithValue(ctx, usageCollectorKey{}, collector), collector
+}
+
+// ReportUsage adds the usage to the collectors of the context, if there are any.
+func ReportUsage(ctx context.Context, usage domain.Usage) {
+	collector, _ := ctx.Value(usageCollectorKey{}).(*UsageCollector)
+	for ; collector != nil; collector = collector.parent {
+		collector.add(usage)
+	}
+}
+
+func (c *UsageCollector) add(usage domain.Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.usages = append(c.usages, usage)
+}
+
+func (c *UsageCollector) Usages() []domain.Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]domain.Usage(nil), c.usages...)
+}
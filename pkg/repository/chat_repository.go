@@ -29,6 +29,17 @@ func (c *chatRepository) Save(ctx context.Context, chat *domain.Chat) error {
 		Set("image_model = EXCLUDED.image_model").
 		Set("ttl = EXCLUDED.ttl").
 		Set("system_prompt = EXCLUDED.system_prompt").
+		Set("summary = EXCLUDED.summary").
+		Set("reasoning = EXCLUDED.reasoning").
+		Set("image_aspect_ratio = EXCLUDED.image_aspect_ratio").
+		Set("image_size = EXCLUDED.image_size").
+		Set("image_quality = EXCLUDED.image_quality").
+		Set("image_count = EXCLUDED.image_count").
+		Set("temperature = EXCLUDED.temperature").
+		Set("top_p = EXCLUDED.top_p").
+		Set("max_tokens = EXCLUDED.max_tokens").
+		Set("presence_penalty = EXCLUDED.presence_penalty").
+		Set("frequency_penalty = EXCLUDED.frequency_penalty").
 		Set("messages = EXCLUDED.messages").
 		Set("last_update = EXCLUDED.last_update").
 		Exec(ctx)
@@ -57,6 +68,7 @@ func (c *chatRepository) DeleteMessages(ctx context.Context, chat *domain.Chat)
 	_, err := c.db.NewUpdate().
 		Model((*domain.Chat)(nil)).
 		Set("messages = null").
+		Set("summary = null").
 		Where("id = ?", chat.ID).
 		Where("topic_id = ?", chat.TopicID).
 		Exec(ctx)
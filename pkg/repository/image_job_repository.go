@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/uptrace/bun"
+)
+
+type imageJobRepository struct {
+	db *bun.DB
+}
+
+func NewImageJobRepository(db *bun.DB) *imageJobRepository {
+	return &imageJobRepository{db: db}
+}
+
+// Save saves the job along with its predictions.
+func (i *imageJobRepository) Save(ctx context.Context, job *domain.ImageJob) error {
+	job.CreatedAt = time.Now()
+
+	err := i.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(job).Returning("id").Exec(ctx); err != nil {
+			return err
+		}
+
+		if len(job.Predictions) == 0 {
+			return nil
+		}
+		for n := range job.Predictions {
+			job.Predictions[n].JobID = job.ID
+		}
+		_, err := tx.NewInsert().Model(&job.Predictions).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("saving image job: %w", err)
+	}
+
+	return nil
+}
+
+// Claim starts the job queued first and returns it. Jobs claimed by others are skipped.
+func (i *imageJobRepository) Claim(ctx context.Context) (*domain.ImageJob, error) {
+	var job domain.ImageJob
+
+	next := i.db.NewSelect().
+		Model((*domain.ImageJob)(nil)).
+		Column("id").
+		Where("status = ?", domain.ImageJobStatusQueued).
+		Order("id").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+
+	err := i.db.NewUpdate().
+		Model(&job).
+		Set("status = ?", domain.ImageJobStatusRunning).
+		Set("started_at = ?", time.Now()).
+		Where("id = (?)", next).
+		Returning("*").
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("claiming image job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Running returns the jobs started but not finished, e.g. before a restart, along with
+// their predictions and the images awaiting delivery.
+func (i *imageJobRepository) Running(ctx context.Context) ([]domain.ImageJob, error) {
+	var jobs []domain.ImageJob
+
+	err := i.db.NewSelect().
+		Model(&jobs).
+		Relation("Predictions").
+		Relation("Images").
+		Where("image_job.status IN (?)", bun.In([]domain.ImageJobStatus{
+			domain.ImageJobStatusRunning,
+			domain.ImageJobStatusSubmitting,
+			domain.ImageJobStatusPending,
+			domain.ImageJobStatusDelivering,
+		})).
+		Order("id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching running image jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// GetByID returns the job along with its predictions.
+func (i *imageJobRepository) GetByID(ctx context.Context, id int64) (*domain.ImageJob, error) {
+	var job domain.ImageJob
+
+	err := i.db.NewSelect().
+		Model(&job).
+		Relation("Predictions").
+		Where("image_job.id = ?", id).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("fetching image job by id %d: %w", id, err)
+	}
+
+	return &job, nil
+}
+
+// GetByPredictionID returns the job of the prediction along with all of its predictions.
+func (i *imageJobRepository) GetByPredictionID(ctx context.Context, predictionID string) (*domain.ImageJob, error) {
+	var job domain.ImageJob
+
+	err := i.db.NewSelect().
+		Model(&job).
+		Relation("Predictions").
+		Where("image_job.id = (?)", i.db.NewSelect().
+			Model((*domain.ImagePrediction)(nil)).
+			Column("job_id").
+			Where("id = ?", predictionID)).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("fetching image job by prediction id %s: %w", predictionID, err)
+	}
+
+	return &job, nil
+}
+
+// AddPrediction saves a prediction submitted for the job it names.
+func (i *imageJobRepository) AddPrediction(ctx context.Context, prediction *domain.ImagePrediction) error {
+	_, err := i.db.NewInsert().
+		Model(prediction).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("saving image prediction %s: %w", prediction.ID, err)
+	}
+
+	return nil
+}
+
+// CompletePrediction saves the outcome of the prediction. It reports false if the
+// prediction completed already, e.g. when the provider posts it twice.
+func (i *imageJobRepository) CompletePrediction(ctx context.Context, prediction *domain.ImagePrediction) (bool, error) {
+	res, err := i.db.NewUpdate().
+		Model(prediction).
+		Column("output", "error", "completed_at").
+		WherePK().
+		Where("completed_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, fmt.Errorf("completing image prediction %s: %w", prediction.ID, err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("completing image prediction %s: %w", prediction.ID, err)
+	}
+
+	return rows > 0, nil
+}
+
+// UpdateStatus moves the job from the status to the one set on it. It reports false if
+// the job is not in the status anymore, so that only one caller moves it.
+func (i *imageJobRepository) UpdateStatus(ctx context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error) {
+	return updateImageJobStatus(ctx, i.db, job, from)
+}
+
+// StartDelivery moves the job from the status to delivering and keeps its images until
+// they are delivered. It reports false if the job is not in the status anymore.
+func (i *imageJobRepository) StartDelivery(ctx context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error) {
+	job.Status = domain.ImageJobStatusDelivering
+
+	var moved bool
+	err := i.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		if moved, err = updateImageJobStatus(ctx, tx, job, from); err != nil || !moved {
+			return err
+		}
+
+		if len(job.Images) == 0 {
+			return nil
+		}
+		for n := range job.Images {
+			job.Images[n].JobID = job.ID
+		}
+		_, err = tx.NewInsert().Model(&job.Images).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("starting delivery of image job %d: %w", job.ID, err)
+	}
+
+	return moved, nil
+}
+
+// Finish moves the delivered job to its final status and drops its images.
+func (i *imageJobRepository) Finish(ctx context.Context, job *domain.ImageJob) error {
+	job.CompletedAt = time.Now()
+
+	err := i.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := updateImageJobStatus(ctx, tx, job, domain.ImageJobStatusDelivering); err != nil {
+			return err
+		}
+
+		_, err := tx.NewDelete().
+			Model((*domain.ImageJobImage)(nil)).
+			Where("job_id = ?", job.ID).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("finishing image job %d: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+// Position returns the place of the queued job in the queue, starting from 1.
+func (i *imageJobRepository) Position(ctx context.Context, job *domain.ImageJob) (int, error) {
+	count, err := i.db.NewSelect().
+		Model((*domain.ImageJob)(nil)).
+		Where("status = ?", domain.ImageJobStatusQueued).
+		Where("id <= ?", job.ID).
+		Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("counting image jobs ahead of %d: %w", job.ID, err)
+	}
+
+	return count, nil
+}
+
+// Unfinished returns the jobs of the chat not delivered yet along with their prompts,
+// the queued ones with their places in the queue.
+func (i *imageJobRepository) Unfinished(ctx context.Context, chatID int64, topicID int) ([]domain.ImageJob, error) {
+	var jobs []domain.ImageJob
+
+	position := i.db.NewSelect().
+		TableExpr("image_jobs AS ahead").
+		ColumnExpr("COUNT(*)").
+		Where("ahead.status = ?", domain.ImageJobStatusQueued).
+		Where("ahead.id <= image_job.id")
+
+	err := i.db.NewSelect().
+		Model(&jobs).
+		Relation("Prompt").
+		ColumnExpr("image_job.*").
+		ColumnExpr("CASE WHEN image_job.status = ? THEN (?) ELSE 0 END AS position", domain.ImageJobStatusQueued, position).
+		Where("image_job.chat_id = ?", chatID).
+		Where("image_job.topic_id = ?", topicID).
+		Where("image_job.status NOT IN (?)", bun.In([]domain.ImageJobStatus{domain.ImageJobStatusSucceeded, domain.ImageJobStatusFailed})).
+		Order("image_job.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching unfinished image jobs of chat %d: %w", chatID, err)
+	}
+
+	return jobs, nil
+}
+
+func updateImageJobStatus(ctx context.Context, db bun.IDB, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error) {
+	res, err := db.NewUpdate().
+		Model(job).
+		Column("status", "error", "completed_at").
+		WherePK().
+		Where("status = ?", from).
+		Exec(ctx)
+	if err != nil {
+		return false, fmt.Errorf("updating status of image job %d: %w", job.ID, err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("updating status of image job %d: %w", job.ID, err)
+	}
+
+	return rows > 0, nil
+}
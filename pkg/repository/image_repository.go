@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/uptrace/bun"
+)
+
+type imageRepository struct {
+	db *bun.DB
+}
+
+func NewImageRepository(db *bun.DB) *imageRepository {
+	return &imageRepository{db: db}
+}
+
+func (i *imageRepository) Save(ctx context.Context, image *domain.GeneratedImage) error {
+	image.CreatedAt = time.Now()
+
+	_, err := i.db.NewInsert().
+		Model(image).
+		Returning("id").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("saving generated image: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID returns the image sent to the chat. Images of other chats are not found.
+func (i *imageRepository) GetByID(ctx context.Context, chatID, id int64) (*domain.GeneratedImage, error) {
+	var image domain.GeneratedImage
+
+	err := i.db.NewSelect().
+		Model(&image).
+		Where("id = ?", id).
+		Where("chat_id = ?", chatID).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("fetching generated image by id %d: %w", id, err)
+	}
+
+	return &image, nil
+}
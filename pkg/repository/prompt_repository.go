@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dskvich/ai-bot/pkg/domain"
 	"github.com/uptrace/bun"
@@ -19,6 +20,8 @@ func NewPromptRepository(db *bun.DB) *promptRepository {
 }
 
 func (p *promptRepository) Save(ctx context.Context, prompt *domain.Prompt) error {
+	prompt.CreatedAt = time.Now()
+
 	_, err := p.db.NewInsert().
 		Model(prompt).
 		Returning("id").
@@ -47,3 +50,23 @@ func (p *promptRepository) GetByID(ctx context.Context, id int64) (*domain.Promp
 
 	return &prompt, nil
 }
+
+// ListByChat returns a page of the prompts of the chat, newest first, along with the
+// number of prompts the chat has.
+func (p *promptRepository) ListByChat(ctx context.Context, chatID int64, topicID int, offset, limit int) ([]domain.Prompt, int, error) {
+	var prompts []domain.Prompt
+
+	total, err := p.db.NewSelect().
+		Model(&prompts).
+		Where("chat_id = ?", chatID).
+		Where("topic_id = ?", topicID).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching prompts of chat %d: %w", chatID, err)
+	}
+
+	return prompts, total, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/uptrace/bun"
+)
+
+type quotaRepository struct {
+	db *bun.DB
+}
+
+func NewQuotaRepository(db *bun.DB) *quotaRepository {
+	return &quotaRepository{db: db}
+}
+
+func (q *quotaRepository) Save(ctx context.Context, quota *domain.Quota) error {
+	quota.UpdatedAt = time.Now()
+
+	_, err := q.db.NewInsert().
+		Model(quota).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("daily = EXCLUDED.daily").
+		Set("monthly = EXCLUDED.monthly").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("saving quota: %w", err)
+	}
+
+	return nil
+}
+
+func (q *quotaRepository) Get(ctx context.Context, userID int64) (*domain.Quota, error) {
+	var quota domain.Quota
+
+	err := q.db.NewSelect().
+		Model(&quota).
+		Where("user_id = ?", userID).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("fetching quota of user %d: %w", userID, err)
+	}
+
+	return &quota, nil
+}
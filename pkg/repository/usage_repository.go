@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/uptrace/bun"
+)
+
+type usageRepository struct {
+	db *bun.DB
+}
+
+func NewUsageRepository(db *bun.DB) *usageRepository {
+	return &usageRepository{db: db}
+}
+
+func (u *usageRepository) Save(ctx context.Context, record *domain.UsageRecord) error {
+	_, err := u.db.NewInsert().
+		Model(record).
+		Returning("id").
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("saving usage record: %w", err)
+	}
+
+	return nil
+}
+
+// SpendByUser returns the cost of usage since the given time per user, the biggest spenders first.
+func (u *usageRepository) SpendByUser(ctx context.Context, since time.Time) ([]domain.UserSpend, error) {
+	var spends []domain.UserSpend
+
+	err := u.db.NewSelect().
+		Model((*domain.UsageRecord)(nil)).
+		Column("user_id").
+		ColumnExpr("MAX(user_name) AS user_name").
+		ColumnExpr("SUM(cost) AS cost").
+		Where("created_at >= ?", since).
+		Group("user_id").
+		Order("cost DESC").
+		Scan(ctx, &spends)
+	if err != nil {
+		return nil, fmt.Errorf("fetching spend by user: %w", err)
+	}
+
+	return spends, nil
+}
+
+// UserTotal returns the cost of usage of a single user since the given time.
+func (u *usageRepository) UserTotal(ctx context.Context, userID int64, since time.Time) (float64, error) {
+	var total float64
+
+	err := u.db.NewSelect().
+		Model((*domain.UsageRecord)(nil)).
+		ColumnExpr("COALESCE(SUM(cost), 0)").
+		Where("user_id = ?", userID).
+		Where("created_at >= ?", since).
+		Scan(ctx, &total)
+	if err != nil {
+		return 0, fmt.Errorf("fetching spend of user %d: %w", userID, err)
+	}
+
+	return total, nil
+}
+
+// Total returns the cost of usage of all users since the given time.
+func (u *usageRepository) Total(ctx context.Context, since time.Time) (float64, error) {
+	var total float64
+
+	err := u.db.NewSelect().
+		Model((*domain.UsageRecord)(nil)).
+		ColumnExpr("COALESCE(SUM(cost), 0)").
+		Where("created_at >= ?", since).
+		Scan(ctx, &total)
+	if err != nil {
+		return 0, fmt.Errorf("fetching total spend: %w", err)
+	}
+
+	return total, nil
+}
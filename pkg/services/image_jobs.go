@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/samber/lo"
+)
+
+// The outcome of a job is sent a few times, waiting longer after every failure, before
+// the job is left delivering, to be delivered again on start.
+const (
+	deliveryAttempts   = 3
+	deliveryRetryDelay = 5 * time.Second
+)
+
+type PredictionImager interface {
+	PredictionImages(ctx context.Context, model string, prediction *domain.Prediction) ([][]byte, error)
+}
+
+type ImageJobFinisher interface {
+	CompletePrediction(ctx context.Context, prediction *domain.ImagePrediction) (bool, error)
+	StartDelivery(ctx context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error)
+	Finish(ctx context.Context, job *domain.ImageJob) error
+}
+
+// ImageDeliverer sends the outcome of a job to the chat it came from.
+type ImageDeliverer interface {
+	Deliver(ctx context.Context, job *domain.ImageJob, images []domain.Image) error
+	Fail(ctx context.Context, job *domain.ImageJob, err error) error
+}
+
+type UsageRecorder interface {
+	Save(ctx context.Context, record *domain.UsageRecord) error
+}
+
+// jobFinisher completes the image jobs, whether their images come from the queue, polled
+// predictions or a webhook.
+type jobFinisher struct {
+	predictions PredictionImager
+	jobs        ImageJobFinisher
+	deliverer   ImageDeliverer
+	recorder    UsageRecorder
+	retryDelay  time.Duration
+}
+
+func newJobFinisher(predictions PredictionImager, jobs ImageJobFinisher, deliverer ImageDeliverer, recorder UsageRecorder) *jobFinisher {
+	return &jobFinisher{
+		predictions: predictions,
+		jobs:        jobs,
+		deliverer:   deliverer,
+		recorder:    recorder,
+		retryDelay:  deliveryRetryDelay,
+	}
+}
+
+// completePrediction saves the outcome of the prediction of the job, unless it is saved
+// already.
+func (f *jobFinisher) completePrediction(ctx context.Context, job *domain.ImageJob, prediction *domain.Prediction) error {
+	_, i, ok := lo.FindIndexOf(job.Predictions, func(p domain.ImagePrediction) bool { return p.ID == prediction.ID })
+	if !ok || !job.Predictions[i].CompletedAt.IsZero() {
+		return nil
+	}
+
+	saved := job.Predictions[i]
+	saved.Complete(prediction)
+	if _, err := f.jobs.CompletePrediction(ctx, &saved); err != nil {
+		return err
+	}
+	job.Predictions[i] = saved
+
+	return nil
+}
+
+// finishPredictions downloads the images of the completed predictions of the pending job
+// and delivers them as one album. Predictions that failed are left out, unless all of
+// them did.
+func (f *jobFinisher) finishPredictions(ctx context.Context, job *domain.ImageJob) {
+	usageCtx, collector := llm.ContextWithUsageCollector(ctx)
+
+	var (
+		images []domain.Image
+		errs   []error
+	)
+	for _, prediction := range job.Predictions {
+		data, err := f.predictions.PredictionImages(usageCtx, job.Model, prediction.Prediction())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prediction %s: %w", prediction.ID, err))
+			continue
+		}
+		for _, d := range data {
+			images = append(images, domain.Image{Data: d, Model: job.Model})
+		}
+	}
+
+	err := errors.Join(errs...)
+	if len(images) > 0 && err != nil {
+		slog.WarnContext(ctx, "Some predictions of image job failed", "jobID", job.ID, logger.Err(err))
+		err = nil
+	}
+
+	f.finish(ctx, job, images, collector.Usages(), err)
+}
+
+// finish keeps the images of the job, or the error, records the usage of drawing them on
+// behalf of the user of the job and delivers them. Jobs moved on by others, e.g. when the
+// same predictions are both polled and posted, are left as they are.
+func (f *jobFinisher) finish(ctx context.Context, job *domain.ImageJob, images []domain.Image, usages []domain.Usage, err error) {
+	if err == nil && len(images) == 0 {
+		err = errors.New("no images were drawn")
+	}
+
+	from := job.Status
+	job.Error, job.Images = "", nil
+	if err != nil {
+		job.Error = err.Error()
+	}
+	for _, image := range images {
+		job.Images = append(job.Images, domain.ImageJobImage{Model: image.Model, Data: image.Data})
+	}
+
+	started, startErr := f.jobs.StartDelivery(ctx, job, from)
+	if startErr != nil || !started {
+		job.Status = from
+	}
+	if startErr != nil {
+		slog.ErrorContext(ctx, "Failed to start delivery of image job", "jobID", job.ID, logger.Err(startErr))
+		return
+	}
+	if !started {
+		slog.InfoContext(ctx, "Image job already finished", "jobID", job.ID)
+		return
+	}
+
+	for _, usage := range usages {
+		record := domain.NewUsageRecord(job.UserID, job.UserName, job.ChatID, job.TopicID, usage)
+		if err := f.recorder.Save(ctx, record); err != nil {
+			slog.ErrorContext(ctx, "Failed to save usage", "usage", usage, logger.Err(err))
+		}
+	}
+
+	f.deliver(ctx, job, err)
+}
+
+// deliver sends the images of the delivering job, or the error it failed with, to its
+// chat and then finishes the job. Failed deliveries are retried a few times, then the
+// job stays delivering.
+func (f *jobFinisher) deliver(ctx context.Context, job *domain.ImageJob, cause error) {
+	if cause == nil && job.Error != "" {
+		cause = errors.New(job.Error)
+	}
+
+	images := lo.Map(job.Images, func(image domain.ImageJobImage, _ int) domain.Image {
+		return domain.Image{Data: image.Data, Model: image.Model}
+	})
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if cause != nil {
+			err = f.deliverer.Fail(ctx, job, cause)
+		} else {
+			err = f.deliverer.Deliver(ctx, job, images)
+		}
+		if err == nil || attempt == deliveryAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * f.retryDelay):
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to deliver image job", "jobID", job.ID, logger.Err(err))
+		return
+	}
+
+	job.Status = domain.ImageJobStatusSucceeded
+	if cause != nil {
+		job.Status = domain.ImageJobStatusFailed
+		slog.WarnContext(ctx, "Image job failed", "jobID", job.ID, logger.Err(cause))
+	} else {
+		slog.InfoContext(ctx, "Image job succeeded", "jobID", job.ID, "count", len(images))
+	}
+
+	if err := f.jobs.Finish(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "Failed to finish image job", "jobID", job.ID, logger.Err(err))
+	}
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// predictionTimeout is how long a job waits for its predictions before the ones still
+// running are given up.
+const predictionTimeout = 15 * time.Minute
+
+type ImageJobQueue interface {
+	ImageJobFinisher
+	Claim(ctx context.Context) (*domain.ImageJob, error)
+	Running(ctx context.Context) ([]domain.ImageJob, error)
+	GetByID(ctx context.Context, id int64) (*domain.ImageJob, error)
+	UpdateStatus(ctx context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error)
+}
+
+type ImageJobDrawer interface {
+	DrawImage(ctx context.Context, job *domain.ImageJob, image []byte, prompt string) ([]domain.Image, bool, error)
+	Queued() <-chan struct{}
+}
+
+type PredictionPoller interface {
+	PredictionImager
+	GetPrediction(ctx context.Context, predictionID string) (*domain.Prediction, error)
+}
+
+type ImageUpscaler interface {
+	UpscaleImage(ctx context.Context, image []byte) ([]byte, error)
+}
+
+type PromptProvider interface {
+	GetByID(ctx context.Context, id int64) (*domain.Prompt, error)
+}
+
+type FileDownloader interface {
+	DownloadFile(ctx context.Context, fileID string) ([]byte, error)
+}
+
+type QuotaChecker interface {
+	Check(ctx context.Context, userID int64, now time.Time) error
+}
+
+type imageQueue struct {
+	workers      int
+	pollInterval time.Duration
+	jobs         ImageJobQueue
+	drawer       ImageJobDrawer
+	predictions  PredictionPoller
+	upscaler     ImageUpscaler
+	prompts      PromptProvider
+	files        FileDownloader
+	quotas       QuotaChecker
+	finisher     *jobFinisher
+}
+
+// NewImageQueue creates a service drawing and upscaling the queued image jobs, at most
+// workers at once. The queue and the predictions of the jobs are polled every interval.
+// Quotas are checked again when the turn of a job comes, as jobs drawn meanwhile may
+// have spent them.
+func NewImageQueue(
+	workers int,
+	pollInterval time.Duration,
+	jobs ImageJobQueue,
+	drawer ImageJobDrawer,
+	predictions PredictionPoller,
+	upscaler ImageUpscaler,
+	prompts PromptProvider,
+	files FileDownloader,
+	quotas QuotaChecker,
+	deliverer ImageDeliverer,
+	recorder UsageRecorder,
+) (*imageQueue, error) {
+	if workers <= 0 {
+		return nil, errors.New("number of workers must be positive")
+	}
+	if pollInterval <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+	return &imageQueue{
+		workers:      workers,
+		pollInterval: pollInterval,
+		jobs:         jobs,
+		drawer:       drawer,
+		predictions:  predictions,
+		upscaler:     upscaler,
+		prompts:      prompts,
+		files:        files,
+		quotas:       quotas,
+		finisher:     newJobFinisher(predictions, jobs, deliverer, recorder),
+	}, nil
+}
+
+func (q *imageQueue) Name() string { return "image_queue" }
+
+func (q *imageQueue) Start(ctx context.Context) error {
+	slog.Info("Starting service", "name", q.Name(), "workers", q.workers)
+	defer slog.Info("Service stopped", "name", q.Name())
+
+	slots := make(chan struct{}, q.workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// work runs in a slot of a worker, which the caller takes
+	work := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			fn()
+		}()
+	}
+
+	q.resume(ctx, func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			fn()
+		}()
+	})
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		job, err := q.jobs.Claim(ctx)
+		if err != nil {
+			<-slots
+			if !errors.Is(err, domain.ErrNotFound) && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Failed to claim image job", logger.Err(err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			case <-q.drawer.Queued():
+			}
+			continue
+		}
+
+		work(func() { q.run(ctx, job) })
+	}
+}
+
+// resume picks up the jobs a restart interrupted: the ones drawn while waiting go back to
+// their places in the queue, the ones awaiting predictions poll them again and the ones
+// not delivered are delivered again. Jobs interrupted while submitting predictions await
+// the ones submitted, if any, or fail, as submitting them again could draw and bill their
+// images twice.
+func (q *imageQueue) resume(ctx context.Context, schedule func(fn func())) {
+	jobs, err := q.jobs.Running(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get running image jobs", logger.Err(err))
+		return
+	}
+
+	for _, job := range jobs {
+		switch job.Status {
+		case domain.ImageJobStatusRunning:
+			job.Status = domain.ImageJobStatusQueued
+			if _, err := q.jobs.UpdateStatus(ctx, &job, domain.ImageJobStatusRunning); err != nil {
+				slog.ErrorContext(ctx, "Failed to requeue image job", "jobID", job.ID, logger.Err(err))
+			}
+		case domain.ImageJobStatusSubmitting:
+			if len(job.Predictions) == 0 {
+				q.finisher.finish(ctx, &job, nil, nil, errors.New("interrupted while submitting predictions"))
+				continue
+			}
+			job.Status = domain.ImageJobStatusPending
+			if _, err := q.jobs.UpdateStatus(ctx, &job, domain.ImageJobStatusSubmitting); err != nil {
+				slog.ErrorContext(ctx, "Failed to resume image job", "jobID", job.ID, logger.Err(err))
+				continue
+			}
+			schedule(func() { q.await(ctx, &job) })
+		case domain.ImageJobStatusPending:
+			schedule(func() { q.await(ctx, &job) })
+		case domain.ImageJobStatusDelivering:
+			schedule(func() { q.finisher.deliver(ctx, &job, nil) })
+		}
+	}
+
+	if len(jobs) > 0 {
+		slog.InfoContext(ctx, "Image jobs resumed", "count", len(jobs))
+	}
+}
+
+// run draws the images of the job and sends them to its chat. Jobs drawn by predictions
+// are finished once the predictions complete. Jobs interrupted by a shutdown are left
+// as they are, to be resumed on start.
+func (q *imageQueue) run(ctx context.Context, job *domain.ImageJob) {
+	slog.InfoContext(ctx, "Image job started", "jobID", job.ID, "kind", job.Kind, "model", job.Model)
+
+	if err := q.quotas.Check(ctx, job.UserID, time.Now()); err != nil {
+		q.finisher.finish(ctx, job, nil, nil, err)
+		return
+	}
+
+	drawCtx, collector := llm.ContextWithUsageCollector(ctx)
+
+	images, submitted, err := q.draw(drawCtx, job)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if submitted {
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to submit some predictions", "jobID", job.ID, logger.Err(err))
+		}
+		q.await(ctx, job)
+		return
+	}
+
+	q.finisher.finish(ctx, job, images, collector.Usages(), err)
+}
+
+// draw draws the images of the job, or upscales its source image. True is reported if
+// the images are drawn by predictions in the background.
+func (q *imageQueue) draw(ctx context.Context, job *domain.ImageJob) ([]domain.Image, bool, error) {
+	var source []byte
+	if job.SourceFileID != "" {
+		var err error
+		if source, err = q.files.DownloadFile(ctx, job.SourceFileID); err != nil {
+			return nil, false, fmt.Errorf("downloading source image: %w", err)
+		}
+	}
+
+	if job.Kind == domain.ImageJobKindUpscale {
+		upscaled, err := q.upscaler.UpscaleImage(ctx, source)
+		if err != nil {
+			return nil, false, err
+		}
+		return []domain.Image{{Data: upscaled, Model: job.Model}}, false, nil
+	}
+
+	prompt, err := q.prompts.GetByID(ctx, int64(job.PromptID))
+	if err != nil {
+		return nil, false, fmt.Errorf("fetching prompt: %w", err)
+	}
+
+	return q.drawer.DrawImage(ctx, job, source, prompt.Text)
+}
+
+// await polls the predictions of the pending job until they complete, unless the webhook
+// gets them first, and finishes the job. Predictions still running when the wait times
+// out are given up.
+func (q *imageQueue) await(ctx context.Context, job *domain.ImageJob) {
+	timeout := time.NewTimer(predictionTimeout)
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		var timedOut bool
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			timedOut = true
+		case <-ticker.C:
+		}
+
+		if q.poll(ctx, job, timedOut) || timedOut {
+			return
+		}
+	}
+}
+
+// poll saves the outcome of the completed predictions of the job and finishes the job
+// once all of them completed, failing the running ones if given up. It reports whether
+// the job is done.
+func (q *imageQueue) poll(ctx context.Context, job *domain.ImageJob, giveUp bool) bool {
+	current, err := q.jobs.GetByID(ctx, job.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get image job", "jobID", job.ID, logger.Err(err))
+		return false
+	}
+	if current.Status != domain.ImageJobStatusPending {
+		return true
+	}
+
+	for _, saved := range current.Predictions {
+		if !saved.CompletedAt.IsZero() {
+			continue
+		}
+
+		prediction, err := q.predictions.GetPrediction(ctx, saved.ID)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to poll prediction", "predictionID", saved.ID, logger.Err(err))
+			prediction = &domain.Prediction{ID: saved.ID}
+		}
+		if !prediction.Done && giveUp {
+			prediction = &domain.Prediction{ID: saved.ID, Done: true, Err: errors.New("prediction timed out")}
+		}
+		if !prediction.Done {
+			continue
+		}
+
+		if err := q.finisher.completePrediction(ctx, current, prediction); err != nil {
+			slog.ErrorContext(ctx, "Failed to save prediction", "predictionID", saved.ID, logger.Err(err))
+		}
+	}
+
+	if !current.Completed() {
+		return false
+	}
+
+	q.finisher.finishPredictions(ctx, current)
+
+	return true
+}
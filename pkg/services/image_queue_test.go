@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+)
+
+func (s *testJobStore) Claim(context.Context) (*domain.ImageJob, error) {
+	return nil, domain.ErrNotFound
+}
+
+func (s *testJobStore) Running(context.Context) ([]domain.ImageJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []domain.ImageJob
+	for _, job := range s.jobs {
+		copied := *job
+		copied.Predictions = slices.Clone(job.Predictions)
+		jobs = append(jobs, copied)
+	}
+	return jobs, nil
+}
+
+func (s *testJobStore) GetByID(_ context.Context, id int64) (*domain.ImageJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *s.jobs[id-1]
+	copied.Predictions = slices.Clone(s.jobs[id-1].Predictions)
+	return &copied, nil
+}
+
+func (s *testJobStore) UpdateStatus(_ context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.jobs[job.ID-1]
+	if stored.Status != from {
+		return false, nil
+	}
+	stored.Status = job.Status
+	return true, nil
+}
+
+// testPoller answers every poll with the predictions it knows, as succeeded.
+type testPoller struct {
+	imageStandIn
+	done map[string]bool
+}
+
+func (p *testPoller) GetPrediction(_ context.Context, predictionID string) (*domain.Prediction, error) {
+	return &domain.Prediction{ID: predictionID, Done: p.done[predictionID], Output: []byte(`"data:image/png;base64,aW1hZ2U="`)}, nil
+}
+
+func TestImageQueueResume(t *testing.T) {
+	wt := newWebhookTest(t, "")
+	poller := &testPoller{imageStandIn: wt.stand, done: map[string]bool{"p1": true, "p2": true}}
+
+	queue, err := NewImageQueue(1, time.Millisecond, wt.jobs, nil, poller, nil, nil, nil, nil, wt.deliverer, wt.recorder)
+	if err != nil {
+		t.Fatalf("NewImageQueue: %v", err)
+	}
+	queue.finisher.retryDelay = 0
+
+	running := wt.addJob()
+	submittingWithout := wt.addJob()
+	submittingWith := wt.addJob("p1")
+	pending := wt.addJob("p2")
+
+	statuses := map[int64]domain.ImageJobStatus{
+		running:           domain.ImageJobStatusRunning,
+		submittingWithout: domain.ImageJobStatusSubmitting,
+		submittingWith:    domain.ImageJobStatusSubmitting,
+		pending:           domain.ImageJobStatusPending,
+	}
+	for id, status := range statuses {
+		wt.jobs.jobs[id-1].Status = status
+	}
+
+	queue.resume(context.Background(), func(fn func()) { fn() })
+
+	want := map[int64]domain.ImageJobStatus{
+		running:           domain.ImageJobStatusQueued,
+		submittingWithout: domain.ImageJobStatusFailed,
+		submittingWith:    domain.ImageJobStatusSucceeded,
+		pending:           domain.ImageJobStatusSucceeded,
+	}
+	for id, status := range want {
+		if got := wt.jobs.status(id); got != status {
+			t.Errorf("job %d resumed from %s: status = %s, want %s", id, statuses[id], got, status)
+		}
+	}
+
+	if got := wt.deliveries(); got != 2 {
+		t.Errorf("deliveries = %d, want one per job awaiting predictions", got)
+	}
+	if got := len(wt.deliverer.failed); got != 1 {
+		t.Errorf("failures = %d, want one for the job interrupted before submitting", got)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+type ModelCatalogRefresher interface {
+	Refresh(ctx context.Context)
+}
+
+type modelCatalog struct {
+	catalog  ModelCatalogRefresher
+	interval time.Duration
+}
+
+// NewModelCatalog creates a service refreshing the catalog on start and then every interval.
+func NewModelCatalog(catalog ModelCatalogRefresher, interval time.Duration) (*modelCatalog, error) {
+	if interval <= 0 {
+		return nil, errors.New("refresh interval must be positive")
+	}
+	return &modelCatalog{
+		catalog:  catalog,
+		interval: interval,
+	}, nil
+}
+
+func (m *modelCatalog) Name() string { return "model_catalog" }
+
+func (m *modelCatalog) Start(ctx context.Context) error {
+	slog.Info("Starting service", "name", m.Name())
+	defer slog.Info("Service stopped", "name", m.Name())
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.catalog.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
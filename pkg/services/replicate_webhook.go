@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/logger"
+)
+
+// ReplicateWebhookPath is where Replicate posts completed predictions.
+const ReplicateWebhookPath = "/webhooks/replicate"
+
+const (
+	maxWebhookSize  = 1 << 20
+	shutdownTimeout = 5 * time.Second
+)
+
+type PredictionReader interface {
+	PredictionImager
+	ParsePrediction(header http.Header, body []byte) (*domain.Prediction, error)
+}
+
+type ImageJobProvider interface {
+	ImageJobFinisher
+	GetByPredictionID(ctx context.Context, predictionID string) (*domain.ImageJob, error)
+}
+
+type replicateWebhook struct {
+	addr        string
+	predictions PredictionReader
+	jobs        ImageJobProvider
+	finisher    *jobFinisher
+}
+
+// NewReplicateWebhook creates a service listening on addr for the predictions Replicate
+// posts, sending the images to the chats of their jobs.
+func NewReplicateWebhook(
+	addr string,
+	predictions PredictionReader,
+	jobs ImageJobProvider,
+	deliverer ImageDeliverer,
+	recorder UsageRecorder,
+) (*replicateWebhook, error) {
+	if addr == "" {
+		return nil, errors.New("listen address cannot be empty")
+	}
+	return &replicateWebhook{
+		addr:        addr,
+		predictions: predictions,
+		jobs:        jobs,
+		finisher:    newJobFinisher(predictions, jobs, deliverer, recorder),
+	}, nil
+}
+
+func (r *replicateWebhook) Name() string { return "replicate_webhook" }
+
+func (r *replicateWebhook) Start(ctx context.Context) error {
+	slog.Info("Starting service", "name", r.Name(), "addr", r.addr)
+	defer slog.Info("Service stopped", "name", r.Name())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+ReplicateWebhookPath, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(r.handle(ctx, req))
+	})
+
+	server := &http.Server{
+		Addr:              r.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("listening: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// handle saves the posted prediction and returns the status to answer with. The images
+// of a job are delivered as one album once all of its predictions completed. Predictions
+// of unknown jobs are answered with 404, so that Replicate retries them in case the job
+// is not saved yet.
+func (r *replicateWebhook) handle(ctx context.Context, req *http.Request) int {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookSize))
+	if err != nil {
+		return http.StatusBadRequest
+	}
+
+	prediction, err := r.predictions.ParsePrediction(req.Header, body)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected webhook", logger.Err(err))
+		if errors.Is(err, llm.ErrInvalidWebhook) {
+			return http.StatusUnauthorized
+		}
+		return http.StatusBadRequest
+	}
+
+	if !prediction.Done {
+		return http.StatusOK
+	}
+
+	job, err := r.complete(ctx, prediction)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			slog.WarnContext(ctx, "Received prediction of unknown job", "predictionID", prediction.ID)
+			return http.StatusNotFound
+		}
+		slog.ErrorContext(ctx, "Failed to save prediction", "predictionID", prediction.ID, logger.Err(err))
+		return http.StatusInternalServerError
+	}
+
+	if job.Status == domain.ImageJobStatusPending && job.Completed() {
+		r.finisher.finishPredictions(ctx, job)
+	}
+
+	return http.StatusOK
+}
+
+// complete saves the outcome of the prediction and returns its job as it is afterwards,
+// so that of predictions completing at once, the last one to be saved sees them all.
+func (r *replicateWebhook) complete(ctx context.Context, prediction *domain.Prediction) (*domain.ImageJob, error) {
+	job, err := r.jobs.GetByPredictionID(ctx, prediction.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.finisher.completePrediction(ctx, job, prediction); err != nil {
+		return nil, err
+	}
+
+	return r.jobs.GetByPredictionID(ctx, prediction.ID)
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm/fake"
+	"github.com/dskvich/ai-bot/pkg/llm/replicate"
+)
+
+var testWebhookSecret = "whsec_" + base64.StdEncoding.EncodeToString([]byte("test webhook secret"))
+
+// testJobStore keeps the image jobs along with their predictions.
+type testJobStore struct {
+	mu   sync.Mutex
+	jobs []*domain.ImageJob
+}
+
+func (s *testJobStore) GetByPredictionID(_ context.Context, predictionID string) (*domain.ImageJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		for _, prediction := range job.Predictions {
+			if prediction.ID == predictionID {
+				copied := *job
+				copied.Predictions = slices.Clone(job.Predictions)
+				return &copied, nil
+			}
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (s *testJobStore) CompletePrediction(_ context.Context, prediction *domain.ImagePrediction) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		for i, stored := range job.Predictions {
+			if stored.ID == prediction.ID && stored.CompletedAt.IsZero() {
+				job.Predictions[i] = *prediction
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *testJobStore) StartDelivery(_ context.Context, job *domain.ImageJob, from domain.ImageJobStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.Status = domain.ImageJobStatusDelivering
+	stored := s.jobs[job.ID-1]
+	if stored.Status != from {
+		return false, nil
+	}
+	stored.Status = job.Status
+	return true, nil
+}
+
+func (s *testJobStore) Finish(_ context.Context, job *domain.ImageJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID-1].Status = job.Status
+	return nil
+}
+
+func (s *testJobStore) status(id int64) domain.ImageJobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jobs[id-1].Status
+}
+
+// testDeliverer passes the outcome of every delivered job on, after failing to deliver
+// as many times as asked to.
+type testDeliverer struct {
+	delivered chan []domain.Image
+	failed    chan error
+	failures  int
+}
+
+func (d *testDeliverer) Deliver(_ context.Context, _ *domain.ImageJob, images []domain.Image) error {
+	if d.failures > 0 {
+		d.failures--
+		return errors.New("telegram is down")
+	}
+	d.delivered <- images
+	return nil
+}
+
+func (d *testDeliverer) Fail(_ context.Context, _ *domain.ImageJob, err error) error {
+	if d.failures > 0 {
+		d.failures--
+		return errors.New("telegram is down")
+	}
+	d.failed <- err
+	return nil
+}
+
+type testRecorder struct {
+	mu      sync.Mutex
+	records []*domain.UsageRecord
+}
+
+func (r *testRecorder) Save(_ context.Context, record *domain.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, record)
+	return nil
+}
+
+// imageStandIn is the offline fake of Replicate.
+type imageStandIn interface {
+	PredictionReader
+	SubmitImage(ctx context.Context, image []byte, prompt string, model string, settings domain.ImageSettings, submitted func(predictionID string) error) ([]string, error)
+}
+
+type webhookTest struct {
+	webhook   *replicateWebhook
+	stand     imageStandIn
+	jobs      *testJobStore
+	deliverer *testDeliverer
+	recorder  *testRecorder
+}
+
+func newWebhookTest(t *testing.T, webhookURL string) *webhookTest {
+	t.Helper()
+
+	wt := &webhookTest{
+		stand:     fake.NewClient(fake.WithWebhook(webhookURL, testWebhookSecret)),
+		jobs:      &testJobStore{},
+		deliverer: &testDeliverer{delivered: make(chan []domain.Image, 10), failed: make(chan error, 10)},
+		recorder:  &testRecorder{},
+	}
+
+	var err error
+	if wt.webhook, err = NewReplicateWebhook(":0", wt.stand, wt.jobs, wt.deliverer, wt.recorder); err != nil {
+		t.Fatalf("NewReplicateWebhook: %v", err)
+	}
+	wt.webhook.finisher.retryDelay = 0
+
+	return wt
+}
+
+// addJob saves a pending job of the predictions and returns its ID.
+func (wt *webhookTest) addJob(predictionIDs ...string) int64 {
+	wt.jobs.mu.Lock()
+	defer wt.jobs.mu.Unlock()
+
+	job := &domain.ImageJob{
+		ID:     int64(len(wt.jobs.jobs) + 1),
+		Model:  domain.FluxKontextPro,
+		Status: domain.ImageJobStatusPending,
+	}
+	for _, predictionID := range predictionIDs {
+		job.Predictions = append(job.Predictions, domain.ImagePrediction{ID: predictionID, JobID: job.ID})
+	}
+	wt.jobs.jobs = append(wt.jobs.jobs, job)
+
+	return job.ID
+}
+
+// post hands a prediction signed at the time with the secret to the webhook.
+func (wt *webhookTest) post(t *testing.T, predictionID string, at time.Time, secret string) int {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{
+		"id":     predictionID,
+		"status": "succeeded",
+		"output": "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("image")),
+	})
+	if err != nil {
+		t.Fatalf("marshal prediction: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	signature, err := replicate.SignWebhook(secret, predictionID, timestamp, body)
+	if err != nil {
+		t.Fatalf("SignWebhook: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, ReplicateWebhookPath, bytes.NewReader(body))
+	req.Header.Set("webhook-id", predictionID)
+	req.Header.Set("webhook-timestamp", timestamp)
+	req.Header.Set("webhook-signature", signature)
+
+	return wt.webhook.handle(context.Background(), req)
+}
+
+func (wt *webhookTest) deliveries() int {
+	return len(wt.deliverer.delivered)
+}
+
+func TestReplicateWebhookRoundTrip(t *testing.T) {
+	var wt *webhookTest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(wt.webhook.handle(req.Context(), req))
+	}))
+	t.Cleanup(srv.Close)
+
+	wt = newWebhookTest(t, srv.URL+ReplicateWebhookPath)
+
+	// A post arriving before the job is saved is answered with 404 and posted again
+	predictionIDs, err := wt.stand.SubmitImage(context.Background(), nil, "a cat", domain.FluxKontextPro, domain.ImageSettings{Count: 2}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("SubmitImage: %v", err)
+	}
+	wt.addJob(predictionIDs...)
+
+	select {
+	case images := <-wt.deliverer.delivered:
+		if len(images) != 2 || len(images[0].Data) == 0 || len(images[1].Data) == 0 {
+			t.Errorf("delivered %d images, want an album of two", len(images))
+		}
+	case err := <-wt.deliverer.failed:
+		t.Fatalf("job failed: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("prediction was not delivered")
+	}
+
+	wt.recorder.mu.Lock()
+	defer wt.recorder.mu.Unlock()
+	if len(wt.recorder.records) != 2 {
+		t.Errorf("recorded %d usages, want one per image", len(wt.recorder.records))
+	}
+}
+
+func TestReplicateWebhookHandle(t *testing.T) {
+	otherSecret := "whsec_" + base64.StdEncoding.EncodeToString([]byte("other secret"))
+
+	tests := []struct {
+		name           string
+		job            bool
+		at             time.Duration // Since now
+		secret         string
+		wantStatus     int
+		wantDeliveries int
+	}{
+		{name: "valid signature", job: true, secret: testWebhookSecret, wantStatus: http.StatusOK, wantDeliveries: 1},
+		{name: "stale timestamp", job: true, at: -10 * time.Minute, secret: testWebhookSecret, wantStatus: http.StatusUnauthorized},
+		{name: "bad signature", job: true, secret: otherSecret, wantStatus: http.StatusUnauthorized},
+		{name: "unknown job", secret: testWebhookSecret, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wt := newWebhookTest(t, "")
+			if tt.job {
+				wt.addJob("p1")
+			}
+
+			if status := wt.post(t, "p1", time.Now().Add(tt.at), tt.secret); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := wt.deliveries(); got != tt.wantDeliveries {
+				t.Errorf("deliveries = %d, want %d", got, tt.wantDeliveries)
+			}
+		})
+	}
+}
+
+func TestReplicateWebhookDuplicatePost(t *testing.T) {
+	wt := newWebhookTest(t, "")
+	wt.addJob("p1")
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if status := wt.post(t, "p1", time.Now(), testWebhookSecret); status != http.StatusOK {
+			t.Errorf("post %d: status = %d, want %d", attempt, status, http.StatusOK)
+		}
+	}
+
+	if got := wt.deliveries(); got != 1 {
+		t.Errorf("deliveries = %d, want 1", got)
+	}
+	if len(wt.recorder.records) != 1 {
+		t.Errorf("recorded %d usages, want one", len(wt.recorder.records))
+	}
+}
+
+func TestReplicateWebhookWaitsForAllPredictions(t *testing.T) {
+	wt := newWebhookTest(t, "")
+	wt.addJob("p1", "p2")
+
+	if status := wt.post(t, "p1", time.Now(), testWebhookSecret); status != http.StatusOK {
+		t.Errorf("first post: status = %d, want %d", status, http.StatusOK)
+	}
+	if got := wt.deliveries(); got != 0 {
+		t.Fatalf("deliveries before the last prediction = %d, want 0", got)
+	}
+
+	if status := wt.post(t, "p2", time.Now(), testWebhookSecret); status != http.StatusOK {
+		t.Errorf("last post: status = %d, want %d", status, http.StatusOK)
+	}
+	if got := wt.deliveries(); got != 1 {
+		t.Fatalf("deliveries = %d, want 1", got)
+	}
+	if images := <-wt.deliverer.delivered; len(images) != 2 {
+		t.Errorf("delivered %d images, want an album of two", len(images))
+	}
+}
+
+func TestReplicateWebhookRetriesFailedDelivery(t *testing.T) {
+	wt := newWebhookTest(t, "")
+	jobID := wt.addJob("p1")
+	wt.deliverer.failures = deliveryAttempts - 1
+
+	if status := wt.post(t, "p1", time.Now(), testWebhookSecret); status != http.StatusOK {
+		t.Errorf("status = %d, want %d", status, http.StatusOK)
+	}
+	if got := wt.deliveries(); got != 1 {
+		t.Errorf("deliveries = %d, want 1", got)
+	}
+	if got := wt.jobs.status(jobID); got != domain.ImageJobStatusSucceeded {
+		t.Errorf("status after delivery = %s, want %s", got, domain.ImageJobStatusSucceeded)
+	}
+}
+
+func TestReplicateWebhookKeepsUndeliveredJobs(t *testing.T) {
+	wt := newWebhookTest(t, "")
+	jobID := wt.addJob("p1")
+	wt.deliverer.failures = deliveryAttempts
+
+	if status := wt.post(t, "p1", time.Now(), testWebhookSecret); status != http.StatusOK {
+		t.Errorf("status = %d, want %d", status, http.StatusOK)
+	}
+	if got := wt.jobs.status(jobID); got != domain.ImageJobStatusDelivering {
+		t.Errorf("status after failed delivery = %s, want %s", got, domain.ImageJobStatusDelivering)
+	}
+	if len(wt.recorder.records) != 1 {
+		t.Errorf("recorded %d usages, want one", len(wt.recorder.records))
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/samber/lo"
+)
+
+func capabilityTitles(capabilities []domain.Capability) string {
+	return strings.Join(lo.Map(capabilities, func(c domain.Capability, _ int) string {
+		return domain.CapabilityTitles[c]
+	}), ", ")
+}
+
+// incapableModelText explains to the user why the chat model can't answer.
+func incapableModelText(err error) string {
+	var incapable *domain.IncapableModelError
+	if !errors.As(err, &incapable) {
+		return fmt.Sprintf("❌ Не удалось выбрать модель: %s", err)
+	}
+	return fmt.Sprintf("🚫 Модель %s не поддерживает: %s. Выберите другую модель: /text_models",
+		incapable.Model, capabilityTitles(incapable.Missing))
+}
+
+// rerouteNote tells the user that a capable model answered instead of the selected one.
+func rerouteNote(selected, answered string, missing []domain.Capability) string {
+	return fmt.Sprintf("↪️ Модель %s не поддерживает: %s, ответила %s.", selected, capabilityTitles(missing), answered)
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+// fileClient downloads the files sent to the bot, giving up on stalled downloads.
+var fileClient = &http.Client{Timeout: time.Minute}
+
+type drawImageSaver interface {
+	Save(ctx context.Context, image *domain.GeneratedImage) error
+}
+
+type drawImageJobs interface {
+	Enqueue(ctx context.Context, job *domain.ImageJob) (int, error)
+}
+
+// enqueueImage queues the job drawing the prompt with the image model and settings of the
+// chat and tells the user the place of the job in the queue. A nil chat uses the defaults.
+// The source photo of the prompt, if any, is edited instead.
+func enqueueImage(ctx context.Context, b *bot.Bot, imageJobs drawImageJobs, prompt *domain.Prompt, chat *domain.Chat, job domain.ImageJob) {
+	if chat == nil {
+		chat = domain.NewChat(job.ChatID, job.TopicID)
+	}
+
+	job.PromptID, job.SourceFileID = prompt.ID, prompt.SourceFileID
+	job.Model, job.Settings = chat.ImageModel, chat.ImageSettings
+
+	enqueueJob(ctx, b, imageJobs, job)
+}
+
+// enqueueJob queues the job and tells the user its place in the queue.
+func enqueueJob(ctx context.Context, b *bot.Bot, imageJobs drawImageJobs, job domain.ImageJob) {
+	position, err := imageJobs.Enqueue(ctx, &job)
+	if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          job.ChatID,
+			MessageThreadID: job.TopicID,
+			Text:            fmt.Sprintf("❌ Не удалось поставить изображение в очередь: %s", err),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "Image job queued", "jobID", job.ID, "kind", job.Kind, "position", position, "model", job.Model)
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          job.ChatID,
+		MessageThreadID: job.TopicID,
+		Text:            fmt.Sprintf("⏳ Место в очереди: %d. Пришлю изображение, как только оно будет готово.", position),
+	})
+}
+
+// newImageJob creates a job drawing on behalf of the user in the chat.
+func newImageJob(from *models.User, chatID int64, topicID int) domain.ImageJob {
+	return domain.ImageJob{
+		Kind:     domain.ImageJobKindDraw,
+		UserID:   from.ID,
+		UserName: lo.CoalesceOrEmpty(from.Username, from.FirstName),
+		ChatID:   chatID,
+		TopicID:  topicID,
+	}
+}
+
+// sendImages sends a single image as a photo and several ones as an album, followed by
+// the buttons to redraw or upscale each of them. The caption goes with the first image.
+// The sent photos are saved for the buttons to find them. An error is returned only if
+// the images were not sent.
+func sendImages(
+	ctx context.Context,
+	b *bot.Bot,
+	imageSaver drawImageSaver,
+	chatID int64,
+	topicID int,
+	promptID int,
+	images []domain.Image,
+	caption string,
+) error {
+	if len(images) == 1 {
+		msg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Photo: &models.InputFileUpload{
+				Data: bytes.NewReader(images[0].Data),
+			},
+			Caption:     caption,
+			ReplyMarkup: imagesKeyboard(promptID, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("sending image: %w", err)
+		}
+
+		imageIDs := saveImages(ctx, imageSaver, promptID, images, []*models.Message{msg})
+		if _, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:      chatID,
+			MessageID:   msg.ID,
+			ReplyMarkup: imagesKeyboard(promptID, imageIDs),
+		}); err != nil {
+			slog.DebugContext(ctx, "Failed to add image buttons", logger.Err(err))
+		}
+		return nil
+	}
+
+	media := make([]models.InputMedia, 0, len(images))
+	for i, image := range images {
+		photo := &models.InputMediaPhoto{
+			Media:           fmt.Sprintf("attach://image%d", i+1),
+			MediaAttachment: bytes.NewReader(image.Data),
+		}
+		if i == 0 {
+			photo.Caption = caption
+		}
+		media = append(media, photo)
+	}
+
+	msgs, err := b.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+		ChatID:          chatID,
+		MessageThreadID: topicID,
+		Media:           media,
+	})
+	if err != nil {
+		return fmt.Errorf("sending images: %w", err)
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          chatID,
+		MessageThreadID: topicID,
+		Text:            "🔄 Перерисовать или 🔍 увеличить изображение по номеру:",
+		ReplyMarkup:     imagesKeyboard(promptID, saveImages(ctx, imageSaver, promptID, images, msgs)),
+	})
+
+	return nil
+}
+
+// saveImages saves the photos of the sent messages and returns their IDs in the order
+// of the images. Images that failed to save get a zero ID and no buttons.
+func saveImages(ctx context.Context, imageSaver drawImageSaver, promptID int, images []domain.Image, msgs []*models.Message) []int64 {
+	imageIDs := make([]int64, len(images))
+
+	for i, msg := range msgs {
+		if i >= len(images) {
+			break
+		}
+
+		image := &domain.GeneratedImage{
+			PromptID: promptID,
+			ChatID:   msg.Chat.ID,
+			FileID:   lo.LastOrEmpty(msg.Photo).FileID,
+			Model:    images[i].Model,
+		}
+		if err := imageSaver.Save(ctx, image); err != nil {
+			slog.ErrorContext(ctx, "Failed to save generated image", "promptID", promptID, logger.Err(err))
+			continue
+		}
+
+		imageIDs[i] = image.ID
+	}
+
+	return imageIDs
+}
+
+// imagesKeyboard offers to draw the prompt once more and, per saved image, to redraw
+// or upscale it. A single image needs no redraw button, as that is what "Еще" does.
+func imagesKeyboard(promptID int, imageIDs []int64) *models.InlineKeyboardMarkup {
+	const moreButtonText = "Еще"
+
+	more := models.InlineKeyboardButton{Text: moreButtonText, CallbackData: domain.GenImageCallbackPrefix + strconv.Itoa(promptID)}
+
+	if len(imageIDs) == 1 {
+		row := []models.InlineKeyboardButton{more}
+		if imageIDs[0] != 0 {
+			row = append(row, models.InlineKeyboardButton{
+				Text:         "🔍 Увеличить",
+				CallbackData: domain.UpscaleImageCallbackPrefix + strconv.FormatInt(imageIDs[0], 10),
+			})
+		}
+		return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+	}
+
+	var redraw, upscale []models.InlineKeyboardButton
+	for i, id := range imageIDs {
+		if id == 0 {
+			continue
+		}
+		redraw = append(redraw, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("🔄 %d", i+1),
+			CallbackData: domain.RedrawImageCallbackPrefix + strconv.FormatInt(id, 10),
+		})
+		upscale = append(upscale, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("🔍 %d", i+1),
+			CallbackData: domain.UpscaleImageCallbackPrefix + strconv.FormatInt(id, 10),
+		})
+	}
+
+	var rows [][]models.InlineKeyboardButton
+	if len(redraw) > 0 {
+		rows = append(rows, redraw, upscale)
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: append(rows, []models.InlineKeyboardButton{more})}
+}
+
+// ImageDelivery sends the images drawn in the background to the chats that asked for them.
+type ImageDelivery struct {
+	b          *bot.Bot
+	imageSaver drawImageSaver
+}
+
+func NewImageDelivery(b *bot.Bot, imageSaver drawImageSaver) *ImageDelivery {
+	return &ImageDelivery{
+		b:          b,
+		imageSaver: imageSaver,
+	}
+}
+
+// Deliver sends the drawn images to the chat of the job, and upscaled ones as files, so
+// that Telegram doesn't compress them.
+func (d *ImageDelivery) Deliver(ctx context.Context, job *domain.ImageJob, images []domain.Image) error {
+	if job.Kind == domain.ImageJobKindUpscale {
+		_, err := d.b.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:          job.ChatID,
+			MessageThreadID: job.TopicID,
+			Document: &models.InputFileUpload{
+				Filename: fmt.Sprintf("image-%d.png", job.ID),
+				Data:     bytes.NewReader(images[0].Data),
+			},
+			Caption: "🔍 Увеличенное изображение",
+		})
+		return err
+	}
+
+	return sendImages(ctx, d.b, d.imageSaver, job.ChatID, job.TopicID, job.PromptID, images, fallbackNote(job.Model, images[0].Model))
+}
+
+// Fail tells the chat why the job failed. Quotas may run out while jobs wait in the queue.
+func (d *ImageDelivery) Fail(ctx context.Context, job *domain.ImageJob, err error) error {
+	text := providerErrorText("сгенерировать изображение", err)
+	if job.Kind == domain.ImageJobKindUpscale {
+		text = providerErrorText("увеличить изображение", err)
+	}
+
+	var exhausted *domain.QuotaExhaustedError
+	if errors.As(err, &exhausted) {
+		text = fmt.Sprintf("⛔ %s исчерпан, пока изображение ждало очереди: $%.2f из $%.2f.",
+			domain.QuotaScopeTitles[exhausted.Scope], exhausted.Spent, exhausted.Limit)
+	}
+
+	_, sendErr := d.b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          job.ChatID,
+		MessageThreadID: job.TopicID,
+		Text:            text,
+	})
+	return sendErr
+}
+
+// DownloadFile downloads a photo sent to the bot, for the jobs editing or upscaling it.
+func (d *ImageDelivery) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	return downloadFile(ctx, d.b, fileID)
+}
+
+func downloadFile(ctx context.Context, b *bot.Bot, fileID string) ([]byte, error) {
+	file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("getting file metadata: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := fileClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -12,13 +11,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/dskvich/ai-bot/pkg/domain"
-	"github.com/dskvich/ai-bot/pkg/render"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/logger"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"github.com/samber/lo"
@@ -31,11 +28,31 @@ type generateContentChatProvider interface {
 
 type generateContentAIService interface {
 	GenerateImagePrompt(ctx context.Context, prompt string) (string, error)
-	CreateChatCompletion(ctx context.Context, chat *domain.Chat) (*domain.Message, error)
+	TranscribeAudio(ctx context.Context, audioFilePath string) (string, error)
 }
 
-type generateContentImageProvider interface {
-	GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error)
+type generateContentIntentClassifier interface {
+	Classify(ctx context.Context, req domain.IntentRequest) domain.Intent
+}
+
+// intentHandler carries out an intent of the message.
+type intentHandler func(ctx context.Context, b *bot.Bot, update *models.Update, prompt *domain.Prompt)
+
+type generateContentTextGenerator interface {
+	CreateChatCompletionStream(ctx context.Context, chat *domain.Chat, onDelta func(delta string)) (*domain.Message, error)
+}
+
+type generateContentHistoryManager interface {
+	Expire(ctx context.Context, chat *domain.Chat)
+	Fit(ctx context.Context, chat *domain.Chat) bool
+}
+
+type generateContentCapabilityGuard interface {
+	Resolve(ctx context.Context, chat *domain.Chat, stream bool) (string, []domain.Capability, error)
+}
+
+type generateContentImageJobs interface {
+	Enqueue(ctx context.Context, job *domain.ImageJob) (int, error)
 }
 
 type generateContentPromptSaver interface {
@@ -50,21 +67,15 @@ func GenerateContent(
 	chatProvider generateContentChatProvider,
 	promptSaver generateContentPromptSaver,
 	aiService generateContentAIService,
-	imageProvider generateContentImageProvider,
+	intentClassifier generateContentIntentClassifier,
+	textGenerator generateContentTextGenerator,
+	historyManager generateContentHistoryManager,
+	capabilityGuard generateContentCapabilityGuard,
+	imageJobs generateContentImageJobs,
 	audioConverter generateContentAudioConverter,
 ) bot.HandlerFunc {
-	const maxTelegramMessageLength = 4096
-	const moreButtonText = "Еще"
-
-	findCutIndex := func(text string, maxLength int) int {
-		if i := strings.LastIndex(text[:maxLength], "<pre>"); i > -1 {
-			return i
-		}
-		if i := strings.LastIndex(text[:maxLength], "\n"); i > -1 {
-			return i
-		}
-		return maxLength
-	}
+	const truncatedHistoryNote = "\n\n✂️ _Начало истории не поместилось в контекст модели и было сокращено._"
+	const reasoningNote = "\n\n🧠 _Токенов на рассуждения: %d_"
 
 	getImageAsBytes := func(link string) ([]byte, error) {
 		resp, err := http.Get(link)
@@ -102,21 +113,31 @@ func GenerateContent(
 		return voiceFilePath, nil
 	}
 
-	getVoiceAsMP3Bytes := func(ctx context.Context, voiceFileURL string) ([]byte, error) {
+	// getVoiceAsMP3File returns the path of the voice converted to MP3, which the caller removes
+	getVoiceAsMP3File := func(ctx context.Context, voiceFileURL string) (string, error) {
 		voiceBytes, err := getImageAsBytes(voiceFileURL)
 		if err != nil {
-			return nil, fmt.Errorf("unable to download voice file: %w", err)
+			return "", fmt.Errorf("unable to download voice file: %w", err)
 		}
 
 		voiceFilePath, err := saveTempVoiceFile(voiceBytes)
 		if err != nil {
-			return nil, fmt.Errorf("unable to save temporary voice file: %w", err)
+			return "", fmt.Errorf("unable to save temporary voice file: %w", err)
 		}
 		defer os.Remove(voiceFilePath)
 
 		mp3Path, err := audioConverter.ConvertToMP3(ctx, voiceFilePath)
 		if err != nil {
-			return nil, fmt.Errorf("unable to convert voice file to mp3 file: %w", err)
+			return "", fmt.Errorf("unable to convert voice file to mp3 file: %w", err)
+		}
+
+		return mp3Path, nil
+	}
+
+	getVoiceAsMP3Bytes := func(ctx context.Context, voiceFileURL string) ([]byte, error) {
+		mp3Path, err := getVoiceAsMP3File(ctx, voiceFileURL)
+		if err != nil {
+			return nil, err
 		}
 		defer os.Remove(mp3Path)
 
@@ -134,81 +155,122 @@ func GenerateContent(
 		return data, nil
 	}
 
-	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+	// drawPrompt saves the prompt and queues drawing the images from it
+	drawPrompt := func(ctx context.Context, b *bot.Bot, update *models.Update, prompt *domain.Prompt) {
 		chatID := update.Message.Chat.ID
 		topicID := update.Message.MessageThreadID
-		prompt := &domain.Prompt{
-			Text: lo.CoalesceOrEmpty(update.Message.Text, update.Message.Caption),
-		}
-
-		isImagePrompt := strings.Contains(strings.ToLower(prompt.Text), "рисуй") ||
-			strings.Contains(strings.ToLower(prompt.Text), "draw")
 
-		if isImagePrompt {
-			newPrompt, err := aiService.GenerateImagePrompt(ctx, prompt.Text)
-			if err != nil {
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
 				b.SendMessage(ctx, &bot.SendMessageParams{
 					ChatID:          chatID,
 					MessageThreadID: topicID,
-					Text:            fmt.Sprintf("❌ Не удалось сгенерировать промпт: %s", err),
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
 				})
 				return
 			}
+		}
 
-			prompt.Text = newPrompt
+		prompt.ChatID, prompt.TopicID = chatID, topicID
+		prompt.UserID = update.Message.From.ID
+		prompt.Model = chat.ImageModel
+
+		if err := promptSaver.Save(ctx, prompt); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось сохранить промпт: %s", err),
+			})
+			return
+		}
 
-			if err := promptSaver.Save(ctx, prompt); err != nil {
+		slog.InfoContext(ctx, "Prompt saved", "prompt", prompt)
+
+		enqueueImage(ctx, b, imageJobs, prompt, chat, newImageJob(update.Message.From, chatID, topicID))
+	}
+
+	transcribeVoice := func(ctx context.Context, voiceFileURL string) (string, error) {
+		mp3Path, err := getVoiceAsMP3File(ctx, voiceFileURL)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(mp3Path)
+
+		return aiService.TranscribeAudio(ctx, mp3Path)
+	}
+
+	// The intents other than chat, which the rest of the handler answers
+	intentHandlers := map[domain.Intent]intentHandler{
+		domain.IntentImageGeneration: func(ctx context.Context, b *bot.Bot, update *models.Update, prompt *domain.Prompt) {
+			newPrompt, err := aiService.GenerateImagePrompt(ctx, prompt.Text)
+			if err != nil {
 				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID:          chatID,
-					MessageThreadID: topicID,
-					Text:            fmt.Sprintf("❌ Не удалось сохранить промпт: %s", err),
+					ChatID:          update.Message.Chat.ID,
+					MessageThreadID: update.Message.MessageThreadID,
+					Text:            providerErrorText("сгенерировать промпт", err),
 				})
 				return
 			}
 
-			slog.InfoContext(ctx, "Prompt saved", "prompt", prompt)
-
-			chat, err := chatProvider.Get(ctx, chatID, topicID)
-			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			prompt.Text = newPrompt
+			drawPrompt(ctx, b, update, prompt)
+		},
+		domain.IntentImageEdit: func(ctx context.Context, b *bot.Bot, update *models.Update, prompt *domain.Prompt) {
+			prompt.SourceFileID = sourcePhoto(update.Message).FileID
+			drawPrompt(ctx, b, update, prompt)
+		},
+		domain.IntentTranscription: func(ctx context.Context, b *bot.Bot, update *models.Update, _ *domain.Prompt) {
+			reply := update.Message.ReplyToMessage
+
+			voiceFile, err := b.GetFile(ctx, &bot.GetFileParams{FileID: reply.Voice.FileID})
+			if err != nil {
 				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID:          chatID,
-					MessageThreadID: topicID,
-					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+					ChatID:          update.Message.Chat.ID,
+					MessageThreadID: update.Message.MessageThreadID,
+					Text:            fmt.Sprintf("❌ Не удалось получить метадату аудио файла: %s", err),
 				})
 				return
 			}
 
-			model := ""
-			if chat != nil {
-				model = chat.ImageModel
-			}
-
-			imageData, err := imageProvider.GenerateImage(ctx, prompt.Text, model)
+			text, err := transcribeVoice(ctx, b.FileDownloadLink(voiceFile))
 			if err != nil {
 				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID:          chatID,
-					MessageThreadID: topicID,
-					Text:            fmt.Sprintf("❌ Не удалось сгенерировать изображение: %s", err),
+					ChatID:          update.Message.Chat.ID,
+					MessageThreadID: update.Message.MessageThreadID,
+					Text:            providerErrorText("расшифровать голосовое сообщение", err),
 				})
 				return
 			}
 
-			slog.InfoContext(ctx, "Image generated", "size", len(imageData))
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          update.Message.Chat.ID,
+				MessageThreadID: update.Message.MessageThreadID,
+				Text:            fmt.Sprintf("🎤 %s", text),
+				ReplyParameters: &models.ReplyParameters{MessageID: reply.ID},
+			})
+		},
+	}
 
-			kb := &models.InlineKeyboardMarkup{
-				InlineKeyboard: [][]models.InlineKeyboardButton{
-					{{Text: moreButtonText, CallbackData: domain.GenImageCallbackPrefix + strconv.Itoa(prompt.ID)}},
-				},
-			}
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+		prompt := &domain.Prompt{
+			Text: lo.CoalesceOrEmpty(update.Message.Text, update.Message.Caption),
+		}
 
-			b.SendPhoto(ctx, &bot.SendPhotoParams{
-				ChatID:          chatID,
-				MessageThreadID: topicID,
-				Photo: &models.InputFileUpload{
-					Data: bytes.NewReader(imageData),
-				},
-				ReplyMarkup: kb,
-			})
+		intent := intentClassifier.Classify(ctx, domain.IntentRequest{
+			Text:     prompt.Text,
+			HasImage: sourcePhoto(update.Message).FileID != "",
+			HasVoice: update.Message.ReplyToMessage != nil && update.Message.ReplyToMessage.Voice != nil,
+		})
+
+		slog.InfoContext(ctx, "Intent classified", "intent", intent)
+
+		if handle, ok := intentHandlers[intent]; ok {
+			handle(ctx, b, update, prompt)
 			return
 		}
 
@@ -294,7 +356,7 @@ func GenerateContent(
 		}
 
 		if time.Now().After(chat.LastUpdate.Add(chat.TTL)) {
-			chat.Messages = nil
+			historyManager.Expire(ctx, chat)
 		}
 
 		content := []domain.ContentPart{{Type: domain.ContentPartTypeText, Data: prompt.Text}}
@@ -320,24 +382,42 @@ func GenerateContent(
 			ContentParts: content,
 		})
 
-		slog.InfoContext(ctx, "Calling AI for chat completion", "model", chat.TextModel, "messagesCount", len(chat.Messages))
-
-		respMessage, err := aiService.CreateChatCompletion(ctx, chat)
+		// A model capable of the request may answer it instead of the selected one
+		selectedModel := chat.TextModel
+		model, missing, err := capabilityGuard.Resolve(ctx, chat, true)
 		if err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID:          chatID,
 				MessageThreadID: topicID,
-				Text:            fmt.Sprintf("❌ Не удалось сгенерировать ответ: %s", err),
+				Text:            incapableModelText(err),
 			})
 			return
 		}
+		chat.TextModel = model
 
-		if respMessage == nil || len(respMessage.ContentParts) == 0 {
-			b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:          chatID,
-				MessageThreadID: topicID,
-				Text:            "❌ Ответ пустой или отсутствует.",
-			})
+		truncated := historyManager.Fit(ctx, chat)
+
+		slog.InfoContext(ctx, "Calling AI for chat completion", "model", chat.TextModel, "messagesCount", len(chat.Messages), "truncated", truncated)
+
+		stream, err := newMessageStream(ctx, b, chatID, topicID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to start message stream", logger.Err(err))
+			return
+		}
+
+		completionCtx, usageCollector := llm.ContextWithUsageCollector(ctx)
+
+		respMessage, err := textGenerator.CreateChatCompletionStream(completionCtx, chat, func(delta string) {
+			stream.Write(ctx, delta)
+		})
+		chat.TextModel = selectedModel
+		if err != nil {
+			stream.Fail(ctx, providerErrorText("сгенерировать ответ", err))
+			return
+		}
+
+		if respMessage == nil || len(respMessage.ContentParts) == 0 || respMessage.ContentParts[0].Data == "" {
+			stream.Fail(ctx, "❌ Ответ пустой или отсутствует.")
 			return
 		}
 
@@ -355,42 +435,33 @@ func GenerateContent(
 
 		part := respMessage.ContentParts[0] // Assume only one part for now
 		if part.Type != domain.ContentPartTypeText {
-			b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:          chatID,
-				MessageThreadID: topicID,
-				Text:            fmt.Sprintf("❌ Неожиданный тип ответа: %+v", part),
-			})
+			stream.Fail(ctx, fmt.Sprintf("❌ Неожиданный тип ответа: %+v", part))
 			return
 		}
 
-		htmlText := render.ToHTML(part.Data)
-		for htmlText != "" {
-			if utf8.RuneCountInString(htmlText) <= maxTelegramMessageLength {
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID:          chatID,
-					MessageThreadID: topicID,
-					Text:            htmlText,
-					ParseMode:       models.ParseModeHTML,
-				})
-				return
-			}
-
-			cutIndex := findCutIndex(htmlText, maxTelegramMessageLength)
-			_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:          chatID,
-				MessageThreadID: topicID,
-				Text:            htmlText[:cutIndex],
-				ParseMode:       models.ParseModeHTML,
-			})
-			if err != nil {
-				b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID:          chatID,
-					MessageThreadID: topicID,
-					Text:            fmt.Sprintf("❌ Не удалось сгенерировать ответ: %s", err),
-				})
-			}
-			htmlText = htmlText[cutIndex:]
-			time.Sleep(time.Second) // Basic rate limit management
+		reply := part.Data
+		if truncated {
+			reply += truncatedHistoryNote
+		}
+		if model != selectedModel {
+			reply += "\n\n_" + rerouteNote(selectedModel, model, missing) + "_"
+		}
+		if note := fallbackNote(model, respMessage.Model); note != "" {
+			reply += "\n\n_" + note + "_"
+		}
+		if reasoningTokens := lo.SumBy(usageCollector.Usages(), func(u domain.Usage) int { return u.ReasoningTokens }); reasoningTokens > 0 {
+			reply += fmt.Sprintf(reasoningNote, reasoningTokens)
 		}
+
+		stream.Finish(ctx, reply)
+	}
+}
+
+// sourcePhoto returns the photo sent along with the message or, failing that, the replied-to one.
+func sourcePhoto(msg *models.Message) models.PhotoSize {
+	photo := lo.LastOrEmpty(msg.Photo)
+	if photo.FileID == "" && msg.ReplyToMessage != nil {
+		photo = lo.LastOrEmpty(msg.ReplyToMessage.Photo)
 	}
+	return photo
 }
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type ManageQuotaProvider interface {
+	Get(ctx context.Context, userID int64) (*domain.Quota, error)
+	Save(ctx context.Context, quota *domain.Quota) error
+}
+
+type ManageQuotaSpendProvider interface {
+	UserTotal(ctx context.Context, userID int64, since time.Time) (float64, error)
+}
+
+// ManageQuota lets admins view a user's quota with "/quota <user_id>" and change it
+// with "/quota <user_id> <daily> <monthly>", amounts in USD, 0 meaning no limit.
+func ManageQuota(quotaProvider ManageQuotaProvider, spendProvider ManageQuotaSpendProvider, defaultQuota domain.Quota, adminIDs []int64) bot.HandlerFunc {
+	const usage = "ℹ️ Использование:\n/quota <user_id> — показать лимиты\n/quota <user_id> <в день> <в месяц> — задать лимиты в $, 0 — без лимита"
+
+	parseAmount := func(s string) (float64, error) {
+		amount, err := strconv.ParseFloat(strings.TrimPrefix(s, "$"), 64)
+		if err != nil || amount < 0 {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		return amount, nil
+	}
+
+	formatLimit := func(limit float64) string {
+		if limit <= 0 {
+			return "без лимита"
+		}
+		return fmt.Sprintf("$%.2f", limit)
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		reply := func(text string) {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            text,
+			})
+		}
+
+		if !slices.Contains(adminIDs, update.Message.From.ID) {
+			reply("❌ Команда доступна только администраторам")
+			return
+		}
+
+		args := strings.Fields(update.Message.Text)[1:]
+		if len(args) != 1 && len(args) != 3 {
+			reply(usage)
+			return
+		}
+
+		userID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			reply(usage)
+			return
+		}
+
+		quota, err := quotaProvider.Get(ctx, userID)
+		if err != nil {
+			if !errors.Is(err, domain.ErrNotFound) {
+				reply(fmt.Sprintf("❌ Не удалось получить лимиты: %s", err))
+				return
+			}
+			quota = &domain.Quota{UserID: userID, Daily: defaultQuota.Daily, Monthly: defaultQuota.Monthly}
+		}
+
+		if len(args) == 3 {
+			if quota.Daily, err = parseAmount(args[1]); err != nil {
+				reply(fmt.Sprintf("❌ Не удалось разобрать дневной лимит: %s", err))
+				return
+			}
+			if quota.Monthly, err = parseAmount(args[2]); err != nil {
+				reply(fmt.Sprintf("❌ Не удалось разобрать месячный лимит: %s", err))
+				return
+			}
+
+			if err = quotaProvider.Save(ctx, quota); err != nil {
+				reply(fmt.Sprintf("❌ Не удалось сохранить лимиты: %s", err))
+				return
+			}
+		}
+
+		now := time.Now()
+
+		spentToday, err := spendProvider.UserTotal(ctx, userID, domain.StartOfDay(now))
+		if err != nil {
+			reply(fmt.Sprintf("❌ Не удалось получить расходы: %s", err))
+			return
+		}
+
+		spentThisMonth, err := spendProvider.UserTotal(ctx, userID, domain.StartOfMonth(now))
+		if err != nil {
+			reply(fmt.Sprintf("❌ Не удалось получить расходы: %s", err))
+			return
+		}
+
+		reply(fmt.Sprintf("📊 Лимиты пользователя %d:\nВ день: %s (потрачено $%.2f)\nВ месяц: %s (потрачено $%.2f)",
+			userID, formatLimit(quota.Daily), spentToday, formatLimit(quota.Monthly), spentThisMonth))
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/dskvich/ai-bot/pkg/render"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	maxTelegramMessageLength = 4096
+	streamPlaceholderText    = "✍️ ..."
+	streamEditInterval       = 1500 * time.Millisecond
+)
+
+// messageStream shows a reply that is still being generated. It sends a
+// placeholder message, edits it as new text arrives and rolls over into a
+// new message once the current one would exceed the Telegram length limit.
+type messageStream struct {
+	b       *bot.Bot
+	chatID  int64
+	topicID int
+
+	messageIDs []int
+	text       strings.Builder
+	committed  int    // bytes of text already moved into previous messages
+	shown      string // text currently displayed in the last message
+	lastEdit   time.Time
+}
+
+func newMessageStream(ctx context.Context, b *bot.Bot, chatID int64, topicID int) (*messageStream, error) {
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          chatID,
+		MessageThreadID: topicID,
+		Text:            streamPlaceholderText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sending placeholder message: %w", err)
+	}
+
+	return &messageStream{
+		b:          b,
+		chatID:     chatID,
+		topicID:    topicID,
+		messageIDs: []int{msg.ID},
+		lastEdit:   time.Now(),
+	}, nil
+}
+
+// Write appends a piece of generated text and refreshes the displayed message
+// if the edit interval has passed.
+func (s *messageStream) Write(ctx context.Context, delta string) {
+	s.text.WriteString(delta)
+
+	for {
+		current := s.text.String()[s.committed:]
+		if utf8.RuneCountInString(current) <= maxTelegramMessageLength {
+			break
+		}
+
+		cut := findPlainCutIndex(current, maxTelegramMessageLength)
+		s.edit(ctx, len(s.messageIDs)-1, current[:cut], "")
+		s.committed += cut
+
+		msg, err := s.b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          s.chatID,
+			MessageThreadID: s.topicID,
+			Text:            streamPlaceholderText,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send rollover message", logger.Err(err))
+			return
+		}
+		s.messageIDs = append(s.messageIDs, msg.ID)
+		s.shown = ""
+	}
+
+	if time.Since(s.lastEdit) < streamEditInterval {
+		return
+	}
+
+	current := s.text.String()[s.committed:]
+	if strings.TrimSpace(current) == "" || current == s.shown {
+		return
+	}
+
+	s.edit(ctx, len(s.messageIDs)-1, current, "")
+	s.shown = current
+}
+
+// Finish replaces the streamed plain text with the final HTML rendering,
+// reusing the already sent messages and removing the ones left unused.
+func (s *messageStream) Finish(ctx context.Context, content string) {
+	pages := splitHTMLMessage(render.ToHTML(content))
+
+	for i, page := range pages {
+		if i < len(s.messageIDs) {
+			s.edit(ctx, i, page, models.ParseModeHTML)
+			continue
+		}
+
+		time.Sleep(time.Second) // Basic rate limit management
+		_, err := s.b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          s.chatID,
+			MessageThreadID: s.topicID,
+			Text:            page,
+			ParseMode:       models.ParseModeHTML,
+		})
+		if err != nil {
+			s.b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          s.chatID,
+				MessageThreadID: s.topicID,
+				Text:            fmt.Sprintf("❌ Не удалось сгенерировать ответ: %s", err),
+			})
+		}
+	}
+
+	for _, id := range s.messageIDs[min(len(pages), len(s.messageIDs)):] {
+		s.b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: s.chatID, MessageID: id})
+	}
+}
+
+// Fail reports an error in place of the placeholder, or below the partial
+// answer when some text has already been shown.
+func (s *messageStream) Fail(ctx context.Context, text string) {
+	if s.text.Len() == 0 && len(s.messageIDs) == 1 {
+		s.edit(ctx, 0, text, "")
+		return
+	}
+
+	s.b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          s.chatID,
+		MessageThreadID: s.topicID,
+		Text:            text,
+	})
+}
+
+func (s *messageStream) edit(ctx context.Context, idx int, text string, parseMode models.ParseMode) {
+	s.lastEdit = time.Now()
+
+	_, err := s.b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    s.chatID,
+		MessageID: s.messageIDs[idx],
+		Text:      text,
+		ParseMode: parseMode,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to edit streamed message", "messageID", s.messageIDs[idx], logger.Err(err))
+	}
+}
+
+// splitHTMLMessage splits rendered HTML into pages that fit into a single Telegram message.
+func splitHTMLMessage(text string) []string {
+	var pages []string
+	for utf8.RuneCountInString(text) > maxTelegramMessageLength {
+		cutIndex := findHTMLCutIndex(text, maxTelegramMessageLength)
+		pages = append(pages, text[:cutIndex])
+		text = text[cutIndex:]
+	}
+
+	if text != "" {
+		pages = append(pages, text)
+	}
+
+	return pages
+}
+
+func findHTMLCutIndex(text string, maxLength int) int {
+	if i := strings.LastIndex(text[:maxLength], "<pre>"); i > 0 {
+		return i
+	}
+	return findPlainCutIndex(text, maxLength)
+}
+
+func findPlainCutIndex(text string, maxLength int) int {
+	limit := len(text)
+	if utf8.RuneCountInString(text) > maxLength {
+		limit = len(string([]rune(text)[:maxLength]))
+	}
+
+	if i := strings.LastIndex(text[:limit], "\n"); i > 0 {
+		return i
+	}
+	return limit
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dskvich/ai-bot/pkg/llm"
+)
+
+// providerErrorText explains a failed model request to the user. Errors the user
+// can act upon get a friendly message, others are reported as failures to do the action.
+func providerErrorText(action string, err error) string {
+	switch {
+	case errors.Is(err, llm.ErrQuotaExceeded):
+		return "💸 У провайдера модели закончился баланс. Сообщите администратору или выберите другую модель."
+	case errors.Is(err, llm.ErrRateLimited):
+		return "⏳ Провайдер модели перегружен запросами. Попробуйте через минуту."
+	case errors.Is(err, llm.ErrEditingUnsupported):
+		return "🚫 Выбранная модель не умеет редактировать изображения. Выберите другую: /image_models"
+	case errors.Is(err, llm.ErrContentPolicy):
+		return "🚫 Провайдер модели отклонил запрос из-за политики контента. Попробуйте переформулировать."
+	default:
+		return fmt.Sprintf("❌ Не удалось %s: %s", action, err)
+	}
+}
+
+// fallbackNote tells the user that a fallback model answered instead of the selected one.
+func fallbackNote(selected, answered string) string {
+	if answered == "" || answered == selected {
+		return ""
+	}
+	return fmt.Sprintf("↪️ Модель %s недоступна, ответила %s.", selected, answered)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type redrawImageImageProvider interface {
+	GetByID(ctx context.Context, chatID, id int64) (*domain.GeneratedImage, error)
+}
+
+type redrawImagePromptProvider interface {
+	GetByID(ctx context.Context, id int64) (*domain.Prompt, error)
+}
+
+type redrawImageChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+}
+
+// RedrawImage draws a single image of an album once more. The chosen image is edited as its
+// prompt asks, so that the new one stays close to it, by the model that drew it if that one
+// edits images and by the image model of the chat otherwise.
+func RedrawImage(
+	imageProvider redrawImageImageProvider,
+	promptProvider redrawImagePromptProvider,
+	imageJobs drawImageJobs,
+	chatProvider redrawImageChatProvider,
+) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.CallbackQuery.Message.Message.Chat.ID
+		topicID := update.CallbackQuery.Message.Message.MessageThreadID
+
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		imageID, err := strconv.ParseInt(strings.TrimPrefix(update.CallbackQuery.Data, domain.RedrawImageCallbackPrefix), 10, 64)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось прочитать ID изображения: %s", update.CallbackQuery.Data),
+			})
+			return
+		}
+
+		image, err := imageProvider.GetByID(ctx, chatID, imageID)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось найти изображение: %s", err),
+			})
+			return
+		}
+
+		prompt, err := promptProvider.GetByID(ctx, int64(image.PromptID))
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось извлечь промпт: %s", err),
+			})
+			return
+		}
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		if domain.CanEditImages(image.Model) {
+			chat.ImageModel = image.Model
+		}
+		chat.ImageSettings.Count = 1
+
+		source := *prompt
+		source.SourceFileID = image.FileID
+
+		slog.InfoContext(ctx, "Redrawing image", "imageID", imageID)
+
+		enqueueImage(ctx, b, imageJobs, &source, chat, newImageJob(&update.CallbackQuery.From, chatID, topicID))
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -18,21 +17,15 @@ type regenerateImagePromptProvider interface {
 	GetByID(ctx context.Context, id int64) (*domain.Prompt, error)
 }
 
-type regenerateImageProvider interface {
-	GenerateImage(ctx context.Context, prompt string, model string) ([]byte, error)
-}
-
 type regenerateImageChatProvider interface {
 	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
 }
 
 func RegenerateImage(
 	promptProvider regenerateImagePromptProvider,
-	imageProvider regenerateImageProvider,
+	imageJobs drawImageJobs,
 	chatProvider regenerateImageChatProvider,
 ) bot.HandlerFunc {
-	const moreButtonText = "Еще"
-
 	parsePromptID := func(promptIDRaw string) (int64, error) {
 		idStr := strings.TrimPrefix(promptIDRaw, domain.GenImageCallbackPrefix)
 
@@ -66,6 +59,10 @@ func RegenerateImage(
 		slog.InfoContext(ctx, "PromptID parsed", "id", promptID)
 
 		prompt, err := promptProvider.GetByID(ctx, promptID)
+		if err == nil && prompt.ChatID != chatID {
+			// Prompts of other chats, and those saved before prompts knew their chat, are not rerun.
+			err = domain.ErrNotFound
+		}
 		if err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID:          chatID,
@@ -77,48 +74,16 @@ func RegenerateImage(
 
 		slog.InfoContext(ctx, "Prompt fetched", "prompt", prompt)
 
-		model := ""
 		chat, err := chatProvider.Get(ctx, chatID, topicID)
 		if err != nil && !errors.Is(err, domain.ErrNotFound) {
-			b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:          update.Message.Chat.ID,
-				MessageThreadID: update.Message.MessageThreadID,
-				Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
-			})
-			return
-		}
-
-		if chat != nil {
-			model = chat.ImageModel
-		}
-
-		imageData, err := imageProvider.GenerateImage(ctx, prompt.Text, model)
-		if err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID:          chatID,
 				MessageThreadID: topicID,
-				Text:            fmt.Sprintf("❌ Не удалось сгенерировать изображение: %s", err),
+				Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
 			})
 			return
 		}
 
-		slog.InfoContext(ctx, "Image generated", "size", len(imageData), "model", model)
-
-		kb := &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{
-					{Text: moreButtonText, CallbackData: domain.GenImageCallbackPrefix + strconv.FormatInt(promptID, 10)},
-				},
-			},
-		}
-
-		b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:          chatID,
-			MessageThreadID: topicID,
-			Photo: &models.InputFileUpload{
-				Data: bytes.NewReader(imageData),
-			},
-			ReplyMarkup: kb,
-		})
+		enqueueImage(ctx, b, imageJobs, prompt, chat, newImageJob(&update.CallbackQuery.From, chatID, topicID))
 	}
 }
@@ -9,7 +9,6 @@ import (
 	"github.com/dskvich/ai-bot/pkg/domain"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/samber/lo"
 )
 
 type SetImageModelChatProvider interface {
@@ -17,19 +16,23 @@ type SetImageModelChatProvider interface {
 	Save(ctx context.Context, chat *domain.Chat) error
 }
 
-func SetImageModel(chatProvider SetImageModelChatProvider, supportedImageModels []string) bot.HandlerFunc {
-	parseImageModel := func(modelRaw string) (string, error) {
+type SetImageModelCatalog interface {
+	Model(id string) (domain.ModelInfo, bool)
+}
+
+func SetImageModel(chatProvider SetImageModelChatProvider, catalog SetImageModelCatalog) bot.HandlerFunc {
+	parseImageModel := func(modelRaw string) (domain.ModelInfo, error) {
 		if !strings.HasPrefix(modelRaw, domain.SetImageModelCallbackPrefix) {
-			return "", fmt.Errorf("invalid format, expected prefix '%s'", domain.SetImageModelCallbackPrefix)
+			return domain.ModelInfo{}, fmt.Errorf("invalid format, expected prefix '%s'", domain.SetImageModelCallbackPrefix)
 		}
 
 		model := strings.TrimPrefix(modelRaw, domain.SetImageModelCallbackPrefix)
 
-		if lo.Contains(supportedImageModels, model) {
-			return model, nil
+		if info, ok := catalog.Model(model); ok && info.Kind == domain.ModelKindImage {
+			return info, nil
 		}
 
-		return "", errors.New("unsupported model")
+		return domain.ModelInfo{}, errors.New("unsupported model")
 	}
 
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -41,7 +44,7 @@ func SetImageModel(chatProvider SetImageModelChatProvider, supportedImageModels
 			ShowAlert:       false,
 		})
 
-		model, err := parseImageModel(update.CallbackQuery.Data)
+		info, err := parseImageModel(update.CallbackQuery.Data)
 		if err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID:          chatID,
@@ -65,7 +68,7 @@ func SetImageModel(chatProvider SetImageModelChatProvider, supportedImageModels
 			}
 		}
 
-		chat.ImageModel = model
+		chat.ImageModel = info.ID
 
 		if err = chatProvider.Save(ctx, chat); err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
@@ -76,20 +79,10 @@ func SetImageModel(chatProvider SetImageModelChatProvider, supportedImageModels
 			return
 		}
 
-		var displayName string
-		switch model {
-		case domain.DallE2Model:
-			displayName = "DALL-E 2"
-		case domain.DallE3Model:
-			displayName = "DALL-E 3"
-		default:
-			displayName = model
-		}
-
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID:          chatID,
 			MessageThreadID: topicID,
-			Text:            "✅ Модель для генерации изображений установлена: " + displayName,
+			Text:            "✅ Модель для генерации изображений установлена: " + info.Name,
 		})
 	}
 }
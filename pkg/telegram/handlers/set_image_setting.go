@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type SetImageSettingChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+	Save(ctx context.Context, chat *domain.Chat) error
+}
+
+func SetImageSetting(chatProvider SetImageSettingChatProvider) bot.HandlerFunc {
+	// applyChange parses callback data like "imgset_aspect_16:9" and changes the chat accordingly.
+	// An empty value resets the setting.
+	applyChange := func(chat *domain.Chat, data string) error {
+		if !strings.HasPrefix(data, domain.SetImageSettingCallbackPrefix) {
+			return fmt.Errorf("invalid format, expected prefix '%s'", domain.SetImageSettingCallbackPrefix)
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(data, domain.SetImageSettingCallbackPrefix), "_")
+		if !ok {
+			return errors.New("invalid format, expected setting and value")
+		}
+
+		if key == imageSettingAll {
+			chat.ImageSettings = domain.ImageSettings{}
+			return nil
+		}
+
+		setting, ok := domain.ImageSettingByKey(key)
+		if !ok {
+			return fmt.Errorf("unsupported setting %q", key)
+		}
+
+		if !setting.Set(&chat.ImageSettings, value) {
+			return fmt.Errorf("unsupported value %q", value)
+		}
+
+		return nil
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.CallbackQuery.Message.Message.Chat.ID
+		topicID := update.CallbackQuery.Message.Message.MessageThreadID
+
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		if err := applyChange(chat, update.CallbackQuery.Data); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось изменить настройку: %s", err),
+			})
+			return
+		}
+
+		if err = chatProvider.Save(ctx, chat); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось сохранить чат: %s", err),
+			})
+			return
+		}
+
+		// Fails with "message is not modified" when resetting settings that are already default
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   update.CallbackQuery.Message.Message.ID,
+			Text:        imageSettingsText(chat),
+			ReplyMarkup: imageSettingsKeyboard(chat),
+		}); err != nil {
+			slog.DebugContext(ctx, "Image settings message not updated", logger.Err(err))
+		}
+	}
+}
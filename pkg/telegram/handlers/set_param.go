@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type SetParamChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+	Save(ctx context.Context, chat *domain.Chat) error
+}
+
+func SetParam(chatProvider SetParamChatProvider) bot.HandlerFunc {
+	// applyChange parses callback data like "params_inc_top_p" and changes the chat accordingly.
+	applyChange := func(chat *domain.Chat, data string) error {
+		if !strings.HasPrefix(data, domain.SetParamCallbackPrefix) {
+			return fmt.Errorf("invalid format, expected prefix '%s'", domain.SetParamCallbackPrefix)
+		}
+
+		op, key, ok := strings.Cut(strings.TrimPrefix(data, domain.SetParamCallbackPrefix), "_")
+		if !ok {
+			return errors.New("invalid format, expected operation and parameter")
+		}
+
+		if op == paramReset && key == paramAll {
+			for _, param := range domain.GenerationParams {
+				param.Reset(chat)
+			}
+			return nil
+		}
+
+		param, ok := domain.GenerationParamByKey(key)
+		if !ok {
+			return fmt.Errorf("unsupported parameter %q", key)
+		}
+
+		switch op {
+		case paramIncrease:
+			param.Change(chat, true)
+		case paramDecrease:
+			param.Change(chat, false)
+		case paramReset:
+			param.Reset(chat)
+		default:
+			return fmt.Errorf("unsupported operation %q", op)
+		}
+
+		return nil
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.CallbackQuery.Message.Message.Chat.ID
+		topicID := update.CallbackQuery.Message.Message.MessageThreadID
+
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		if err := applyChange(chat, update.CallbackQuery.Data); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось изменить параметр: %s", err),
+			})
+			return
+		}
+
+		if err = chatProvider.Save(ctx, chat); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось сохранить чат: %s", err),
+			})
+			return
+		}
+
+		// Fails with "message is not modified" when a value is already at its limit
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   update.CallbackQuery.Message.Message.ID,
+			Text:        paramsText(chat),
+			ReplyMarkup: paramsKeyboard(chat),
+		}); err != nil {
+			slog.DebugContext(ctx, "Parameters message not updated", logger.Err(err))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+type SetReasoningChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+	Save(ctx context.Context, chat *domain.Chat) error
+}
+
+func SetReasoning(chatProvider SetReasoningChatProvider) bot.HandlerFunc {
+	parseReasoning := func(reasoningRaw string) (string, error) {
+		if !strings.HasPrefix(reasoningRaw, domain.SetReasoningCallbackPrefix) {
+			return "", fmt.Errorf("invalid format, expected prefix '%s'", domain.SetReasoningCallbackPrefix)
+		}
+
+		effort := strings.TrimPrefix(reasoningRaw, domain.SetReasoningCallbackPrefix)
+
+		if lo.Contains(domain.ReasoningEfforts, effort) {
+			return effort, nil
+		}
+
+		return "", errors.New("unsupported reasoning effort")
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.CallbackQuery.Message.Message.Chat.ID
+		topicID := update.CallbackQuery.Message.Message.MessageThreadID
+
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		effort, err := parseReasoning(update.CallbackQuery.Data)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось извлечь глубину рассуждений: %s", err),
+			})
+			return
+		}
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		chat.Reasoning = effort
+
+		if err = chatProvider.Save(ctx, chat); err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось сохранить чат: %s", err),
+			})
+			return
+		}
+
+		text := "✅ Глубина рассуждений установлена: " + effort
+		if !domain.IsReasoningModel(chat.TextModel) {
+			text += fmt.Sprintf("\nОна применится, когда вы выберете модель o-серии. Текущая модель %s не рассуждает.", chat.TextModel)
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            text,
+		})
+	}
+}
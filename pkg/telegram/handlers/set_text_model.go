@@ -9,7 +9,6 @@ import (
 	"github.com/dskvich/ai-bot/pkg/domain"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/samber/lo"
 )
 
 type SetTextModelChatProvider interface {
@@ -18,19 +17,23 @@ type SetTextModelChatProvider interface {
 	DeleteMessages(ctx context.Context, chat *domain.Chat) error
 }
 
-func SetTextModel(chatProvider SetTextModelChatProvider, supportedTextModels []string) bot.HandlerFunc {
-	parseTextModel := func(modelRaw string) (string, error) {
+type SetTextModelCatalog interface {
+	Model(id string) (domain.ModelInfo, bool)
+}
+
+func SetTextModel(chatProvider SetTextModelChatProvider, catalog SetTextModelCatalog) bot.HandlerFunc {
+	parseTextModel := func(modelRaw string) (domain.ModelInfo, error) {
 		if !strings.HasPrefix(modelRaw, domain.SetTextModelCallbackPrefix) {
-			return "", fmt.Errorf("invalid format, expected prefix '%s'", domain.SetTextModelCallbackPrefix)
+			return domain.ModelInfo{}, fmt.Errorf("invalid format, expected prefix '%s'", domain.SetTextModelCallbackPrefix)
 		}
 
 		model := strings.TrimPrefix(modelRaw, domain.SetTextModelCallbackPrefix)
 
-		if lo.Contains(supportedTextModels, model) {
-			return model, nil
+		if info, ok := catalog.Model(model); ok && info.Kind == domain.ModelKindText {
+			return info, nil
 		}
 
-		return "", errors.New("unsupported model")
+		return domain.ModelInfo{}, errors.New("unsupported model")
 	}
 
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -42,7 +45,7 @@ func SetTextModel(chatProvider SetTextModelChatProvider, supportedTextModels []s
 			ShowAlert:       false,
 		})
 
-		model, err := parseTextModel(update.CallbackQuery.Data)
+		info, err := parseTextModel(update.CallbackQuery.Data)
 		if err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID:          chatID,
@@ -66,7 +69,7 @@ func SetTextModel(chatProvider SetTextModelChatProvider, supportedTextModels []s
 			}
 		}
 
-		chat.TextModel = model
+		chat.TextModel = info.ID
 
 		if err = chatProvider.Save(ctx, chat); err != nil {
 			b.SendMessage(ctx, &bot.SendMessageParams{
@@ -80,7 +83,7 @@ func SetTextModel(chatProvider SetTextModelChatProvider, supportedTextModels []s
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID:          chatID,
 			MessageThreadID: topicID,
-			Text:            "✅ Модель установлена: " + model,
+			Text:            "✅ Модель установлена: " + info.Name,
 		})
 
 		if err = chatProvider.DeleteMessages(ctx, chat); err != nil {
@@ -9,25 +9,20 @@ import (
 	"github.com/samber/lo"
 )
 
-func ShowImageModels(supportedImageModels []string) bot.HandlerFunc {
+type ShowImageModelsCatalog interface {
+	ImageModels() []domain.ModelInfo
+}
 
+func ShowImageModels(catalog ShowImageModelsCatalog) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 		chatID := update.Message.Chat.ID
 		topicID := update.Message.MessageThreadID
 
-		buttons := lo.Map(supportedImageModels, func(model string, _ int) models.InlineKeyboardButton {
-			var displayName string
-			switch model {
-			case domain.DallE2Model:
-				displayName = "DALL-E 2"
-			case domain.DallE3Model:
-				displayName = "DALL-E 3"
-			case domain.FluxProUltra11:
-				displayName = "Flux 1.1 Pro Ultra"
-			default:
-				displayName = model
+		buttons := modelButtons(catalog.ImageModels(), domain.SetImageModelCallbackPrefix, func(info domain.ModelInfo) string {
+			if info.Editing {
+				return info.Name + " ✏️"
 			}
-			return models.InlineKeyboardButton{Text: displayName, CallbackData: domain.SetImageModelCallbackPrefix + model}
+			return info.Name
 		})
 
 		kb := &models.InlineKeyboardMarkup{
@@ -37,7 +32,7 @@ func ShowImageModels(supportedImageModels []string) bot.HandlerFunc {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID:          chatID,
 			MessageThreadID: topicID,
-			Text:            "🎨 Выберите модель для генерации изображений:",
+			Text:            "🎨 Выберите модель для генерации изображений:\n✏️ — умеет редактировать фото: ответьте на фото сообщением «измени …»",
 			ReplyMarkup:     kb,
 		})
 	}
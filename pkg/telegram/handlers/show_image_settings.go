@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const imageSettingAll = "all"
+
+type ShowImageSettingsChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+}
+
+func ShowImageSettings(chatProvider ShowImageSettingsChatProvider) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            imageSettingsText(chat),
+			ReplyMarkup:     imageSettingsKeyboard(chat),
+		})
+	}
+}
+
+func imageSettingsText(chat *domain.Chat) string {
+	var text strings.Builder
+	text.WriteString("🖼 Настройки изображений для этого чата:\n")
+
+	for _, setting := range domain.ImageSettingsMenu {
+		value := "по умолчанию"
+		for _, option := range setting.Options {
+			if option.Value == setting.Value(&chat.ImageSettings) {
+				value = option.Title
+			}
+		}
+		fmt.Fprintf(&text, "\n%s: %s", setting.Title, value)
+	}
+
+	text.WriteString("\n\nМодели выберут ближайшие поддерживаемые значения. " +
+		"Нажмите на выбранный вариант, чтобы вернуть значение по умолчанию.")
+
+	return text.String()
+}
+
+// imageSettingsKeyboard lays out a row of options for every setting. The picked option
+// is marked and resets the setting to the model default.
+func imageSettingsKeyboard(chat *domain.Chat) *models.InlineKeyboardMarkup {
+	callbackData := func(key, value string) string {
+		return domain.SetImageSettingCallbackPrefix + key + "_" + value
+	}
+
+	rows := make([][]models.InlineKeyboardButton, 0, len(domain.ImageSettingsMenu)+1)
+
+	for _, setting := range domain.ImageSettingsMenu {
+		row := make([]models.InlineKeyboardButton, 0, len(setting.Options))
+		for _, option := range setting.Options {
+			if option.Value == setting.Value(&chat.ImageSettings) {
+				row = append(row, models.InlineKeyboardButton{Text: "✅ " + option.Title, CallbackData: callbackData(setting.Key, "")})
+			} else {
+				row = append(row, models.InlineKeyboardButton{Text: option.Title, CallbackData: callbackData(setting.Key, option.Value)})
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, []models.InlineKeyboardButton{
+		{Text: "↩️ Сбросить все", CallbackData: callbackData(imageSettingAll, "")},
+	})
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
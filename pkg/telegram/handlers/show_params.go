@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	paramIncrease = "inc"
+	paramDecrease = "dec"
+	paramReset    = "reset"
+	paramAll      = "all"
+)
+
+type ShowParamsChatProvider interface {
+	Get(ctx context.Context, chatID int64, topicID int) (*domain.Chat, error)
+}
+
+func ShowParams(chatProvider ShowParamsChatProvider) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		chat, err := chatProvider.Get(ctx, chatID, topicID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				chat = domain.NewChat(chatID, topicID)
+			} else {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить чат: %s", err),
+				})
+				return
+			}
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            paramsText(chat),
+			ReplyMarkup:     paramsKeyboard(chat),
+		})
+	}
+}
+
+func paramsText(chat *domain.Chat) string {
+	text := "🎛 Параметры генерации для этого чата.\nНажмите на параметр, чтобы вернуть значение по умолчанию."
+	if domain.IsReasoningModel(chat.TextModel) {
+		text += fmt.Sprintf("\n\n⚠️ Модель %s их не поддерживает, для нее есть /reasoning.", chat.TextModel)
+	}
+	return text
+}
+
+// paramsKeyboard lays out a row of buttons to decrease, reset and increase every parameter.
+func paramsKeyboard(chat *domain.Chat) *models.InlineKeyboardMarkup {
+	callbackData := func(op, key string) string {
+		return domain.SetParamCallbackPrefix + op + "_" + key
+	}
+
+	rows := make([][]models.InlineKeyboardButton, 0, len(domain.GenerationParams)+1)
+
+	for _, param := range domain.GenerationParams {
+		value := "по умолчанию"
+		if v, ok := param.Value(chat); ok {
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+
+		rows = append(rows, []models.InlineKeyboardButton{
+			{Text: "➖", CallbackData: callbackData(paramDecrease, param.Key)},
+			{Text: param.Title + ": " + value, CallbackData: callbackData(paramReset, param.Key)},
+			{Text: "➕", CallbackData: callbackData(paramIncrease, param.Key)},
+		})
+	}
+
+	rows = append(rows, []models.InlineKeyboardButton{
+		{Text: "↩️ Сбросить все", CallbackData: callbackData(paramReset, paramAll)},
+	})
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
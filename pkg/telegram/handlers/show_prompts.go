@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+const (
+	promptsPageSize     = 5
+	maxPromptTextLength = 100
+)
+
+type ShowPromptsPromptProvider interface {
+	ListByChat(ctx context.Context, chatID int64, topicID int, offset, limit int) ([]domain.Prompt, int, error)
+}
+
+// ShowPrompts lists the latest prompts drawn in the chat, with buttons to draw them again.
+func ShowPrompts(promptProvider ShowPromptsPromptProvider) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		text, keyboard, err := promptsPage(ctx, promptProvider, chatID, topicID, 0)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось получить историю промптов: %s", err),
+			})
+			return
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            text,
+			ParseMode:       models.ParseModeHTML,
+			ReplyMarkup:     keyboard,
+		})
+	}
+}
+
+// PagePrompts turns the page of the prompt history shown by ShowPrompts.
+func PagePrompts(promptProvider ShowPromptsPromptProvider) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		// The page is turned in place, which isn't possible once the message is inaccessible.
+		message := update.CallbackQuery.Message.Message
+		if message == nil {
+			slog.DebugContext(ctx, "Prompt history message is inaccessible", "callbackID", update.CallbackQuery.ID)
+			return
+		}
+
+		chatID := message.Chat.ID
+		topicID := message.MessageThreadID
+
+		page, err := strconv.Atoi(strings.TrimPrefix(update.CallbackQuery.Data, domain.PromptsPageCallbackPrefix))
+		if err != nil || page < 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось прочитать номер страницы: %s", update.CallbackQuery.Data),
+			})
+			return
+		}
+
+		text, keyboard, err := promptsPage(ctx, promptProvider, chatID, topicID, page)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось получить историю промптов: %s", err),
+			})
+			return
+		}
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   message.ID,
+			Text:        text,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: keyboard,
+		}); err != nil {
+			slog.DebugContext(ctx, "Prompt history message not updated", logger.Err(err))
+		}
+	}
+}
+
+// promptsPage lays out a page of the prompt history of the chat, newest first. Every
+// prompt gets a button drawing it again with the current image model of the chat.
+func promptsPage(ctx context.Context, promptProvider ShowPromptsPromptProvider, chatID int64, topicID int, page int) (string, models.ReplyMarkup, error) {
+	prompts, total, err := promptProvider.ListByChat(ctx, chatID, topicID, page*promptsPageSize, promptsPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if total == 0 {
+		return "📭 В этом чате еще нет промптов.", nil, nil
+	}
+
+	pages := (total + promptsPageSize - 1) / promptsPageSize
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "🗂 <b>История промптов</b> (страница %d из %d)\n", page+1, pages)
+
+	rerun := make([]models.InlineKeyboardButton, 0, len(prompts))
+	for i, prompt := range prompts {
+		number := page*promptsPageSize + i + 1
+
+		details := []string{prompt.CreatedAt.UTC().Format("02.01.2006 15:04")}
+		if prompt.Model != "" {
+			details = append(details, prompt.Model)
+		}
+		if prompt.SourceFileID != "" {
+			details = append(details, "✏️ правка фото")
+		}
+
+		fmt.Fprintf(&text, "\n<b>%d.</b> <i>%s</i>\n%s\n", number, strings.Join(details, ", "), html.EscapeString(ellipsis(prompt.Text, maxPromptTextLength)))
+
+		rerun = append(rerun, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("🔄 %d", number),
+			CallbackData: domain.GenImageCallbackPrefix + strconv.Itoa(prompt.ID),
+		})
+	}
+
+	var nav []models.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, models.InlineKeyboardButton{Text: "⬅️ Новее", CallbackData: domain.PromptsPageCallbackPrefix + strconv.Itoa(page-1)})
+	}
+	if page+1 < pages {
+		nav = append(nav, models.InlineKeyboardButton{Text: "Старее ➡️", CallbackData: domain.PromptsPageCallbackPrefix + strconv.Itoa(page+1)})
+	}
+
+	rows := lo.Filter([][]models.InlineKeyboardButton{rerun, nav}, func(row []models.InlineKeyboardButton, _ int) bool {
+		return len(row) > 0
+	})
+
+	return text.String(), &models.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
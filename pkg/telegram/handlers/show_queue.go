@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type showQueueJobProvider interface {
+	Unfinished(ctx context.Context, chatID int64, topicID int) ([]domain.ImageJob, error)
+}
+
+// ShowQueue lists the images the chat waits for, with their places in the queue.
+func ShowQueue(jobProvider showQueueJobProvider) bot.HandlerFunc {
+	const maxPromptLength = 50
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		jobs, err := jobProvider.Unfinished(ctx, chatID, topicID)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось получить очередь: %s", err),
+			})
+			return
+		}
+
+		if len(jobs) == 0 {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            "✅ Очередь пуста, все изображения нарисованы.",
+			})
+			return
+		}
+
+		var sb strings.Builder
+		sb.WriteString("🕒 <b>Очередь изображений</b>\n\n")
+
+		for _, job := range jobs {
+			state := "🎨 Рисуется"
+			switch {
+			case job.Status == domain.ImageJobStatusQueued:
+				state = fmt.Sprintf("⏳ Место %d", job.Position)
+			case job.Status == domain.ImageJobStatusDelivering:
+				state = "📤 Отправляется"
+			case job.Kind == domain.ImageJobKindUpscale:
+				state = "🔍 Увеличивается"
+			}
+
+			var prompt string
+			if job.Prompt != nil {
+				prompt = ellipsis(job.Prompt.Text, maxPromptLength)
+			}
+
+			fmt.Fprintf(&sb, "%s, %s: %s\n", state, job.Model, html.EscapeString(prompt))
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            sb.String(),
+			ParseMode:       models.ParseModeHTML,
+		})
+	}
+}
+
+// ellipsis cuts the text to at most maxRunes characters, marking the cut.
+func ellipsis(text string, maxRunes int) string {
+	if runes := []rune(text); len(runes) > maxRunes {
+		return string(runes[:maxRunes]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+func ShowReasoning() bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		buttons := lo.Map(domain.ReasoningEfforts, func(effort string, _ int) models.InlineKeyboardButton {
+			return models.InlineKeyboardButton{Text: effort, CallbackData: domain.SetReasoningCallbackPrefix + effort}
+		})
+
+		kb := &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{buttons},
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            "🧠 Выберите глубину рассуждений для моделей o-серии:",
+			ReplyMarkup:     kb,
+		})
+	}
+}
@@ -9,13 +9,27 @@ import (
 	"github.com/samber/lo"
 )
 
-func ShowTextModels(supportedTextModels []string) bot.HandlerFunc {
+// maxCallbackDataLength is the limit Telegram sets on the callback data of a button.
+const maxCallbackDataLength = 64
+
+type ShowTextModelsCatalog interface {
+	TextModels() []domain.ModelInfo
+}
+
+func ShowTextModels(catalog ShowTextModelsCatalog) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 		chatID := update.Message.Chat.ID
 		topicID := update.Message.MessageThreadID
 
-		buttons := lo.Map(supportedTextModels, func(text string, _ int) models.InlineKeyboardButton {
-			return models.InlineKeyboardButton{Text: text, CallbackData: domain.SetTextModelCallbackPrefix + text}
+		buttons := modelButtons(catalog.TextModels(), domain.SetTextModelCallbackPrefix, func(info domain.ModelInfo) string {
+			text := info.Name
+			if info.Vision {
+				text += " 👁"
+			}
+			if info.Reasoning {
+				text += " 🧠"
+			}
+			return text
 		})
 
 		kb := &models.InlineKeyboardMarkup{
@@ -25,8 +39,20 @@ func ShowTextModels(supportedTextModels []string) bot.HandlerFunc {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID:          chatID,
 			MessageThreadID: topicID,
-			Text:            "⚙️ Выберите текстовую модель GPT:",
+			Text:            "⚙️ Выберите текстовую модель:\n👁 — понимает изображения, 🧠 — рассуждает перед ответом",
 			ReplyMarkup:     kb,
 		})
 	}
 }
+
+// modelButtons makes a button per model, leaving out models whose IDs don't fit into callback data.
+func modelButtons(infos []domain.ModelInfo, prefix string, text func(info domain.ModelInfo) string) []models.InlineKeyboardButton {
+	var buttons []models.InlineKeyboardButton
+	for _, info := range infos {
+		if len(prefix+info.ID) > maxCallbackDataLength {
+			continue
+		}
+		buttons = append(buttons, models.InlineKeyboardButton{Text: text(info), CallbackData: prefix + info.ID})
+	}
+	return buttons
+}
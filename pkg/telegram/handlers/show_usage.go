@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+type ShowUsageSpendProvider interface {
+	SpendByUser(ctx context.Context, since time.Time) ([]domain.UserSpend, error)
+}
+
+func ShowUsage(spendProvider ShowUsageSpendProvider) bot.HandlerFunc {
+	const maxUsersPerPeriod = 5
+
+	formatPeriod := func(title string, spends []domain.UserSpend, userID int64) string {
+		total := lo.SumBy(spends, func(s domain.UserSpend) float64 { return s.Cost })
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "<b>%s:</b> $%.4f\n", title, total)
+
+		for i, spend := range spends {
+			if i == maxUsersPerPeriod {
+				fmt.Fprintf(&sb, "  … и еще %d\n", len(spends)-maxUsersPerPeriod)
+				break
+			}
+
+			name := lo.CoalesceOrEmpty(spend.UserName, fmt.Sprint(spend.UserID))
+			if spend.UserID == userID {
+				name += " (вы)"
+			}
+			fmt.Fprintf(&sb, "  • %s: $%.4f\n", name, spend.Cost)
+		}
+
+		return sb.String()
+	}
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.Message.Chat.ID
+		topicID := update.Message.MessageThreadID
+
+		now := time.Now()
+		periods := []struct {
+			title string
+			since time.Time
+		}{
+			{"Сегодня", domain.StartOfDay(now)},
+			{"Этот месяц", domain.StartOfMonth(now)},
+			{"За все время", time.Time{}},
+		}
+
+		var sb strings.Builder
+		sb.WriteString("📊 Расходы на API (UTC)\n\n")
+
+		for _, period := range periods {
+			spends, err := spendProvider.SpendByUser(ctx, period.since)
+			if err != nil {
+				b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:          chatID,
+					MessageThreadID: topicID,
+					Text:            fmt.Sprintf("❌ Не удалось получить расходы: %s", err),
+				})
+				return
+			}
+
+			sb.WriteString(formatPeriod(period.title, spends, update.Message.From.ID))
+			sb.WriteString("\n")
+		}
+
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: topicID,
+			Text:            sb.String(),
+			ParseMode:       models.ParseModeHTML,
+		})
+	}
+}
@@ -15,10 +15,17 @@ func Start() bot.HandlerFunc {
 ⏳ <b>/ttl</b> — Установить время жизни чата
 📝 <b>/text_models</b> — Выбрать модель для текста
 🖼️ <b>/image_models</b> — Выбрать модель для картинок
+📐 <b>/image_settings</b> — Настроить формат, размер, качество и количество картинок
+🕒 <b>/queue</b> — Посмотреть очередь картинок
+🗂 <b>/prompts</b> — Посмотреть историю промптов и перерисовать любой из них
+🎛 <b>/params</b> — Настроить температуру и другие параметры генерации
+🧠 <b>/reasoning</b> — Настроить глубину рассуждений моделей o-серии
 ⚙️ <b>/system_prompt</b> — Настроить системную инструкцию
+📊 <b>/usage</b> — Посмотреть расходы на API
 
 🖊️ Просто задай мне вопрос — я помогу!
 🎨 Напиши "нарисуй ..." и я создам картинку.
+✏️ Ответь на фото "измени ..." — я отредактирую его.
 🎙 Отправь голосовое сообщение — я пойму.
 📷 Отправь картинку — я опишу её или отвечу на твои вопросы о ней.
 
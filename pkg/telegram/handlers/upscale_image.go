@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type upscaleImageImageProvider interface {
+	GetByID(ctx context.Context, chatID, id int64) (*domain.GeneratedImage, error)
+}
+
+// UpscaleImage queues enlarging a sent image. The image is sent back as a file, so that
+// Telegram doesn't compress it.
+func UpscaleImage(imageProvider upscaleImageImageProvider, imageJobs drawImageJobs) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		chatID := update.CallbackQuery.Message.Message.Chat.ID
+		topicID := update.CallbackQuery.Message.Message.MessageThreadID
+
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       false,
+		})
+
+		imageID, err := strconv.ParseInt(strings.TrimPrefix(update.CallbackQuery.Data, domain.UpscaleImageCallbackPrefix), 10, 64)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось прочитать ID изображения: %s", update.CallbackQuery.Data),
+			})
+			return
+		}
+
+		image, err := imageProvider.GetByID(ctx, chatID, imageID)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            fmt.Sprintf("❌ Не удалось найти изображение: %s", err),
+			})
+			return
+		}
+
+		job := newImageJob(&update.CallbackQuery.From, chatID, topicID)
+		job.Kind, job.PromptID, job.SourceFileID, job.Model = domain.ImageJobKindUpscale, image.PromptID, image.FileID, domain.RealESRGANModel
+
+		slog.InfoContext(ctx, "Upscaling image", "imageID", imageID)
+
+		enqueueJob(ctx, b, imageJobs, job)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type quotaChecker interface {
+	Check(ctx context.Context, userID int64, now time.Time) error
+}
+
+// resetTimeLayout formats when an exhausted limit resets.
+const resetTimeLayout = "02.01.2006 15:04 UTC"
+
+// Quota rejects generation requests of users who have spent their daily or monthly quota,
+// or when the bot has spent its global monthly limit. Commands and settings are never rejected.
+func Quota(quotas quotaChecker) bot.Middleware {
+	isGenerationRequest := func(update *models.Update) bool {
+		switch {
+		case update.Message != nil:
+			return !strings.HasPrefix(update.Message.Text, "/")
+		case update.CallbackQuery != nil:
+			return strings.HasPrefix(update.CallbackQuery.Data, domain.GenImageCallbackPrefix) ||
+				strings.HasPrefix(update.CallbackQuery.Data, domain.RedrawImageCallbackPrefix) ||
+				strings.HasPrefix(update.CallbackQuery.Data, domain.UpscaleImageCallbackPrefix)
+		default:
+			return false
+		}
+	}
+
+	// rejectionText explains which limit is exhausted, or returns an empty string if none is.
+	rejectionText := func(ctx context.Context, userID int64) string {
+		err := quotas.Check(ctx, userID, time.Now())
+		if err == nil {
+			return ""
+		}
+
+		var exhausted *domain.QuotaExhaustedError
+		if errors.As(err, &exhausted) {
+			return fmt.Sprintf("⛔ %s исчерпан: $%.2f из $%.2f. Лимит обновится %s.",
+				domain.QuotaScopeTitles[exhausted.Scope], exhausted.Spent, exhausted.Limit, exhausted.Reset.Format(resetTimeLayout))
+		}
+
+		slog.ErrorContext(ctx, "Failed to check quota", "userID", userID, logger.Err(err))
+		return fmt.Sprintf("❌ Не удалось проверить лимит расходов: %s", err)
+	}
+
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if !isGenerationRequest(update) {
+				next(ctx, b, update)
+				return
+			}
+
+			var (
+				userID  int64
+				chatID  int64
+				topicID int
+			)
+
+			if update.Message != nil {
+				userID, chatID, topicID = update.Message.From.ID, update.Message.Chat.ID, update.Message.MessageThreadID
+			} else {
+				userID = update.CallbackQuery.From.ID
+				chatID, topicID = callbackChat(update.CallbackQuery)
+			}
+
+			text := rejectionText(ctx, userID)
+			if text == "" {
+				next(ctx, b, update)
+				return
+			}
+
+			slog.WarnContext(ctx, "Request rejected by quota", "userID", userID)
+
+			if update.CallbackQuery != nil {
+				b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            text,
+					ShowAlert:       true,
+				})
+				return
+			}
+
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID:          chatID,
+				MessageThreadID: topicID,
+				Text:            text,
+			})
+		}
+	}
+}
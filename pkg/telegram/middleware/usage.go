@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/dskvich/ai-bot/pkg/domain"
+	"github.com/dskvich/ai-bot/pkg/llm"
+	"github.com/dskvich/ai-bot/pkg/logger"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/samber/lo"
+)
+
+type usageRecorder interface {
+	Save(ctx context.Context, record *domain.UsageRecord) error
+}
+
+// Usage collects the model usage reported while an update is handled and stores
+// it, priced, on behalf of the user who sent the update.
+func Usage(recorder usageRecorder) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			ctx, collector := llm.ContextWithUsageCollector(ctx)
+
+			next(ctx, b, update)
+
+			var (
+				from    *models.User
+				chatID  int64
+				topicID int
+			)
+
+			switch {
+			case update.Message != nil:
+				from, chatID, topicID = update.Message.From, update.Message.Chat.ID, update.Message.MessageThreadID
+			case update.CallbackQuery != nil:
+				from = &update.CallbackQuery.From
+				chatID, topicID = callbackChat(update.CallbackQuery)
+			default:
+				return
+			}
+
+			for _, usage := range collector.Usages() {
+				record := domain.NewUsageRecord(from.ID, lo.CoalesceOrEmpty(from.Username, from.FirstName), chatID, topicID, usage)
+				if err := recorder.Save(ctx, record); err != nil {
+					slog.ErrorContext(ctx, "Failed to save usage", "usage", usage, logger.Err(err))
+					continue
+				}
+				slog.InfoContext(ctx, "Usage saved", "model", record.Model, "cost", record.Cost)
+			}
+		}
+	}
+}
+
+// callbackChat returns the chat and topic of the message the pressed button is on. Messages
+// the bot can't access anymore only name their chat, and callbacks without a message
+// fall back to the private chat of the user.
+func callbackChat(query *models.CallbackQuery) (int64, int) {
+	switch {
+	case query.Message.Message != nil:
+		return query.Message.Message.Chat.ID, query.Message.Message.MessageThreadID
+	case query.Message.InaccessibleMessage != nil:
+		return query.Message.InaccessibleMessage.Chat.ID, 0
+	default:
+		return query.From.ID, 0
+	}
+}